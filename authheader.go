@@ -0,0 +1,29 @@
+package GoogleIdTokenVerifier
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrorAuthHeaderMissing   error = errors.New("Authorization header is missing")
+	ErrorAuthHeaderMalformed error = errors.New("Authorization header is not a Bearer token")
+)
+
+// TokenFromAuthHeader returns the token from an Authorization header of the form "Bearer <token>".
+// The scheme is matched case-insensitively and whitespace around the token is ignored
+func TokenFromAuthHeader(header string) (string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", ErrorAuthHeaderMissing
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrorAuthHeaderMalformed
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", ErrorAuthHeaderMalformed
+	}
+	return token, nil
+}
@@ -0,0 +1,39 @@
+package GoogleIdTokenVerifier
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenFromAuthHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		token    string
+		expected error
+	}{
+		{"bearer", "Bearer abc.def.ghi", "abc.def.ghi", nil},
+		{"lower case scheme", "bearer abc.def.ghi", "abc.def.ghi", nil},
+		{"upper case scheme", "BEARER abc.def.ghi", "abc.def.ghi", nil},
+		{"surrounding whitespace", "  Bearer   abc.def.ghi \t", "abc.def.ghi", nil},
+		{"empty", "", "", ErrorAuthHeaderMissing},
+		{"whitespace only", " \t ", "", ErrorAuthHeaderMissing},
+		{"wrong scheme", "Basic dXNlcjpwYXNz", "", ErrorAuthHeaderMalformed},
+		{"scheme prefix", "Bearerabc.def.ghi", "", ErrorAuthHeaderMalformed},
+		{"scheme only", "Bearer", "", ErrorAuthHeaderMalformed},
+		{"scheme and whitespace", "Bearer   ", "", ErrorAuthHeaderMalformed},
+		{"token only", "abc.def.ghi", "", ErrorAuthHeaderMalformed},
+		{"two tokens", "Bearer abc.def.ghi jkl", "", ErrorAuthHeaderMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := TokenFromAuthHeader(tt.header)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+			if token != tt.token {
+				t.Errorf("got %q\nwant %q", token, tt.token)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package GoogleIdTokenVerifier
+
+import (
+	"runtime"
+	"sync"
+)
+
+// VerifyBatch verifies each of authTokens against certs for aud, as VerifyGoogleIDToken would,
+// spreading the work over runtime.NumCPU goroutines.
+// certs' keys are parsed once and shared by every token. The results are parallel to authTokens:
+// for each token, either its TokenInfo or its error is non-nil
+func VerifyBatch(authTokens []string, certs *Certs, aud string) ([]*TokenInfo, []error) {
+	return VerifyBatchWithWorkers(authTokens, certs, aud, 0)
+}
+
+// VerifyBatchWithWorkers is like VerifyBatch, using at most workers goroutines.
+// If workers is zero or negative, runtime.NumCPU is used; 1 verifies the tokens serially
+func VerifyBatchWithWorkers(authTokens []string, certs *Certs, aud string, workers int) ([]*TokenInfo, []error) {
+	tokeninfos := make([]*TokenInfo, len(authTokens))
+	errs := make([]error, len(authTokens))
+	// Parse the keys before the workers start, so that they only read the parsed keys
+	certs.once.Do(certs.parseKeys)
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(authTokens) {
+		workers = len(authTokens)
+	}
+	if workers <= 1 {
+		for i, authToken := range authTokens {
+			tokeninfos[i], errs[i] = VerifyGoogleIDToken(authToken, certs, aud)
+		}
+		return tokeninfos, errs
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				tokeninfos[i], errs[i] = VerifyGoogleIDToken(authTokens[i], certs, aud)
+			}
+		}()
+	}
+	for i := range authTokens {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return tokeninfos, errs
+}
@@ -0,0 +1,92 @@
+package GoogleIdTokenVerifier
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	expiredClaims := testClaims()
+	expiredClaims["exp"] = time.Now().Add(-time.Hour).Unix()
+	valid := signTestToken(t, nil, testClaims())
+	other := strings.Split(signTestToken(t, nil, map[string]interface{}{"sub": "other"}), ".")
+	forged := valid[:strings.LastIndexByte(valid, '.')+1] + other[2]
+
+	tests := []struct {
+		token    string
+		expected error
+	}{
+		{valid, nil},
+		{signTestToken(t, nil, expiredClaims), ErrorTokenExpired},
+		{forged, ErrorTokenSignatureInvalid},
+		{"XXX", ErrorTokenMalformed},
+		{valid, nil},
+	}
+	authTokens := make([]string, len(tests))
+	for i, tt := range tests {
+		authTokens[i] = tt.token
+	}
+
+	for _, workers := range []int{0, 1, 2, 64} {
+		tokeninfos, errs := VerifyBatchWithWorkers(authTokens, testCerts(t), testAud, workers)
+		if len(tokeninfos) != len(tests) || len(errs) != len(tests) {
+			t.Fatalf("workers %d: got %d results and %d errors\nwant %d of each", workers, len(tokeninfos), len(errs), len(tests))
+		}
+		for i, tt := range tests {
+			if !errors.Is(errs[i], tt.expected) {
+				t.Errorf("workers %d, token %d: got %v\nwant %v", workers, i, errs[i], tt.expected)
+			}
+			if (tokeninfos[i] == nil) != (tt.expected != nil) {
+				t.Errorf("workers %d, token %d: got %v\nwant a TokenInfo only when valid", workers, i, tokeninfos[i])
+			}
+		}
+		if tokeninfos[0].Sub != "110169484474386276334" {
+			t.Errorf("got %q\nwant %q", tokeninfos[0].Sub, "110169484474386276334")
+		}
+	}
+}
+
+// TestVerifyBatchParallel shares fresh certs between the workers, so that under -race
+// it checks the keys are only read once the workers start
+func TestVerifyBatchParallel(t *testing.T) {
+	authTokens := make([]string, 100)
+	for i := range authTokens {
+		claims := testClaims()
+		claims["sub"] = strconv.Itoa(i)
+		authTokens[i] = signTestToken(t, nil, claims)
+	}
+	tokeninfos, errs := VerifyBatch(authTokens, testCerts(t), testAud)
+	for i := range authTokens {
+		if errs[i] != nil {
+			t.Fatalf("token %d: got %v\nwant nil", i, errs[i])
+		}
+		if tokeninfos[i].Sub != strconv.Itoa(i) {
+			t.Errorf("got %q\nwant %q", tokeninfos[i].Sub, strconv.Itoa(i))
+		}
+	}
+}
+
+func TestVerifyBatchEmpty(t *testing.T) {
+	tokeninfos, errs := VerifyBatch(nil, testCerts(t), testAud)
+	if len(tokeninfos) != 0 || len(errs) != 0 {
+		t.Errorf("got %v, %v\nwant empty results", tokeninfos, errs)
+	}
+}
+
+func benchmarkVerifyBatch(b *testing.B, workers int) {
+	authTokens := make([]string, 64)
+	for i := range authTokens {
+		authTokens[i] = signTestToken(b, nil, testClaims())
+	}
+	certs := testCerts(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		VerifyBatchWithWorkers(authTokens, certs, testAud, workers)
+	}
+}
+
+func BenchmarkVerifyBatchSerial(b *testing.B)   { benchmarkVerifyBatch(b, 1) }
+func BenchmarkVerifyBatchParallel(b *testing.B) { benchmarkVerifyBatch(b, 0) }
@@ -0,0 +1,241 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCertCache backs Verify and VerifyContext
+var defaultCertCache = &CertCache{}
+
+// defaultMinRefreshInterval throttles forced refetches when MinRefreshInterval is unset, since any token
+// naming an unknown kid forces one
+const defaultMinRefreshInterval = time.Minute
+
+// Prefetch fetches Google's certs into the cache Verify and VerifyContext share, unless it already holds fresh ones.
+// Call it at startup so that the first request to be verified doesn't wait on the network.
+// If client is nil, http.DefaultClient is used
+func Prefetch(ctx context.Context, client *http.Client) error {
+	_, err := defaultCertCache.get(ctx, client, false)
+	return err
+}
+
+// CertCache holds Google's certs in memory until the max-age advertised by
+// the cert endpoint has elapsed. The zero value is ready to use and is safe
+// for concurrent use: when the certs need fetching, concurrent callers share
+// a single request rather than each fetching their own
+type CertCache struct {
+	// Client is used by GetCerts. http.DefaultClient is used if nil
+	Client *http.Client
+	// URL is the JWKS endpoint to fetch from. Google's endpoint is used if empty
+	URL string
+	// Retry controls how failed fetches are retried
+	Retry RetryPolicy
+	// Header holds extra headers to send with each fetch, such as an API key a proxy in front of the endpoint requires
+	Header http.Header
+	// MinRefreshInterval is the least time between forced refetches, by Refresh or for a token naming
+	// an unknown kid. A forced refetch sooner than that returns the cached certs, even if stale,
+	// so that a flood of such tokens can't hammer the endpoint. Zero means a minute, and a negative value doesn't throttle
+	MinRefreshInterval time.Duration
+
+	// parse decodes the body in place of the JWKS decoder, for endpoints serving another format
+	parse func([]byte) (*Certs, error)
+
+	mu        sync.Mutex
+	certs     *Certs
+	etag      string
+	expires   time.Time
+	lastFetch time.Time
+	inflight  *certsCall
+}
+
+// certsCall is a fetch in progress that other callers wait on
+type certsCall struct {
+	done  chan struct{}
+	certs *Certs
+	err   error
+	// abandoned is set when the caller that started the fetch gave up on it, so its error says nothing about the endpoint
+	abandoned bool
+}
+
+// Get returns the cached certs, fetching them with client when the cache is
+// empty or stale. If client is nil, http.DefaultClient is used
+func (c *CertCache) Get(client *http.Client) (*Certs, error) {
+	return c.get(context.Background(), client, false)
+}
+
+// GetCerts is like Get, using c.Client. It makes CertCache a KeyProvider
+func (c *CertCache) GetCerts(ctx context.Context) (*Certs, error) {
+	return c.get(ctx, c.Client, false)
+}
+
+// ExpiresAt returns when the cached certs become stale, as advertised by the cert endpoint's Cache-Control header.
+// It is the zero time if nothing has been fetched yet
+func (c *CertCache) ExpiresAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expires
+}
+
+// Refresh fetches the certs even if the cached copy is still fresh, using c.Client. Like any forced refetch it is
+// throttled by MinRefreshInterval: within a minute, by default, of the last fetch, including the first GetCerts or Get,
+// it does nothing and returns nil. Call it from a background loop, ticking slower than MinRefreshInterval,
+// so that verification rarely waits on the network:
+//
+//	go func() {
+//		// An hour is well past the one-minute default MinRefreshInterval, so every tick fetches
+//		for range time.Tick(time.Hour) {
+//			if err := cache.Refresh(ctx); err != nil {
+//				log.Printf("refreshing certs: %v", err)
+//			}
+//		}
+//	}()
+//
+// A failed refresh leaves the cached certs in place
+func (c *CertCache) Refresh(ctx context.Context) error {
+	_, err := c.get(ctx, c.Client, true)
+	return err
+}
+
+// refresh fetches the certs even if the cached copy is still fresh, for when a token names a kid we don't know yet.
+// It is throttled like Refresh
+func (c *CertCache) refresh(ctx context.Context) (*Certs, error) {
+	return c.get(ctx, c.Client, true)
+}
+
+func (c *CertCache) get(ctx context.Context, client *http.Client, force bool) (*Certs, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for {
+		c.mu.Lock()
+		if c.certs != nil && (!force && time.Now().Before(c.expires) || force && time.Since(c.lastFetch) < c.minRefreshInterval()) {
+			defer c.mu.Unlock()
+			return c.certs, nil
+		}
+		call := c.inflight
+		if call == nil {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, newFetchError(ctx.Err())
+		}
+		// The fetch was abandoned by the caller that started it rather than failing, so try again ourselves
+		if call.abandoned && ctx.Err() == nil {
+			continue
+		}
+		return call.certs, call.err
+	}
+	call := &certsCall{done: make(chan struct{})}
+	c.inflight = call
+	lastFetch := c.lastFetch
+	c.lastFetch = time.Now()
+	certs, etag := c.certs, c.etag
+	c.mu.Unlock()
+
+	call.certs, call.err = c.fetch(ctx, client, certs, etag)
+	// Only the caller's own context counts: a client Timeout also reports a deadline, but that is the endpoint failing
+	call.abandoned = call.err != nil && ctx.Err() != nil
+
+	c.mu.Lock()
+	c.inflight = nil
+	if call.abandoned {
+		// A fetch the caller gave up on says nothing about the endpoint, so it doesn't hold off refreshes
+		c.lastFetch = lastFetch
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.certs, call.err
+}
+
+func (c *CertCache) minRefreshInterval() time.Duration {
+	if c.MinRefreshInterval == 0 {
+		return defaultMinRefreshInterval
+	}
+	return c.MinRefreshInterval
+}
+
+// clientCertCache fetches into a CertCache with a caller's client, as VerifyContext does with the shared cache
+type clientCertCache struct {
+	cache  *CertCache
+	client *http.Client
+}
+
+// GetCerts returns the cached certs, fetching them if they have expired
+func (p clientCertCache) GetCerts(ctx context.Context) (*Certs, error) {
+	return p.cache.get(ctx, p.client, false)
+}
+
+// refresh fetches the certs for a kid the cached copy doesn't have
+func (p clientCertCache) refresh(ctx context.Context) (*Certs, error) {
+	return p.cache.get(ctx, p.client, true)
+}
+
+// fetch requests the certs, revalidating certs with etag if we hold them, and stores the result
+func (c *CertCache) fetch(ctx context.Context, client *http.Client, certs *Certs, etag string) (*Certs, error) {
+	url := c.URL
+	if url == "" {
+		url = googleCertsURL
+	}
+	reqHeader := c.Header.Clone()
+	if certs != nil && etag != "" {
+		if reqHeader == nil {
+			reqHeader = http.Header{}
+		}
+		reqHeader.Set("If-None-Match", etag)
+	}
+	res, err := fetchCerts(ctx, client, url, reqHeader, c.Retry, c.parse == nil)
+	if err != nil {
+		return nil, err
+	}
+	// A 304 confirms the certs we hold are current, so only their expiry moves
+	if !res.notModified {
+		if c.parse != nil {
+			if res.certs, err = c.parse(res.body); err != nil {
+				return nil, err
+			}
+		}
+		certs, etag = res.certs, res.header.Get("ETag")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certs, c.etag = certs, etag
+	c.expires = time.Now().Add(maxAge(res.header))
+	return certs, nil
+}
+
+// maxAge returns the freshness lifetime from the Cache-Control header, less the time the
+// response has already spent in caches according to its Age header,
+// or zero if the response must not be cached
+func maxAge(header http.Header) time.Duration {
+	var age time.Duration
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			age = time.Duration(seconds) * time.Second
+		}
+	}
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && seconds > 0 {
+		age -= time.Duration(seconds) * time.Second
+	}
+	if age < 0 {
+		return 0
+	}
+	return age
+}
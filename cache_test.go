@@ -0,0 +1,701 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCertsServer(cacheControl string, fetches *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(fetches, 1)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write([]byte(googleCertsJSON))
+	}))
+}
+
+func TestCertCacheGet(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=3600, must-revalidate, no-transform", &fetches)
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	for i := 0; i < 3; i++ {
+		certs, err := cache.Get(ts.Client())
+		if err != nil {
+			t.Fatalf("got %v\nwant nil", err)
+		}
+		if len(certs.Keys) != 2 {
+			t.Fatalf("got %d keys\nwant 2", len(certs.Keys))
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	document, err := json.Marshal(testCerts(t))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(document)
+	}))
+	defer ts.Close()
+	saved := defaultCertCache
+	defaultCertCache = &CertCache{URL: ts.URL}
+	defer func() { defaultCertCache = saved }()
+
+	if err := Prefetch(context.Background(), ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if defaultCertCache.ExpiresAt().IsZero() {
+		t.Errorf("got zero expiry\nwant the default cache populated")
+	}
+	// Neither a second Prefetch nor verification fetch again while the certs are fresh
+	if err := Prefetch(context.Background(), ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if _, err := VerifyContext(context.Background(), signTestToken(t, nil, testClaims()), testAud, ts.Client()); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+
+	defaultCertCache = &CertCache{URL: ts.URL + "/missing", Retry: RetryPolicy{MaxAttempts: 1}}
+	if err := Prefetch(context.Background(), ts.Client()); !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+}
+
+func TestCertCacheGetExpired(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=1", &fetches)
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	if _, err := cache.Get(ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if _, err := cache.Get(ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := cache.Get(ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+}
+
+func TestCertCacheGetConcurrent(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=3600", &fetches)
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get(ts.Client()); err != nil {
+				t.Errorf("got %v\nwant nil", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		expected     time.Duration
+	}{
+		{"public, max-age=19680, must-revalidate, no-transform", 19680 * time.Second},
+		{"max-age=60", time.Minute},
+		{"Max-Age=60", time.Minute},
+		{"no-cache, max-age=60", 0},
+		{"no-store", 0},
+		{"max-age=abc", 0},
+		{"max-age=-5", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("Cache-Control", tt.cacheControl)
+		if actual := maxAge(header); actual != tt.expected {
+			t.Errorf("%q: got %v\nwant %v", tt.cacheControl, actual, tt.expected)
+		}
+	}
+}
+
+func TestMaxAgeWithAge(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		age          string
+		expected     time.Duration
+	}{
+		{"public, max-age=3600", "3500", 100 * time.Second},
+		{"public, max-age=3600", "0", time.Hour},
+		{"public, max-age=3600", "", time.Hour},
+		{"public, max-age=3600", "3600", 0},
+		{"public, max-age=3600", "7200", 0},
+		{"public, max-age=3600", "junk", time.Hour},
+		{"public, max-age=3600", "-10", time.Hour},
+		{"no-cache", "10", 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("Cache-Control", tt.cacheControl)
+		if tt.age != "" {
+			header.Set("Age", tt.age)
+		}
+		if actual := maxAge(header); actual != tt.expected {
+			t.Errorf("%q, Age %q: got %v\nwant %v", tt.cacheControl, tt.age, actual, tt.expected)
+		}
+	}
+}
+
+func TestCertCacheAge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Age", "3500")
+		w.Write([]byte(googleCertsJSON))
+	}))
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	if _, err := cache.Get(ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if ttl := time.Until(cache.ExpiresAt()); ttl > 100*time.Second || ttl < 95*time.Second {
+		t.Errorf("got %v\nwant about 100s", ttl)
+	}
+}
+
+func TestCertCacheETag(t *testing.T) {
+	const etag = `"a06af0b68a2119d692cac4abf415ff3788136f65"`
+	var fetches, notModified int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=0")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(googleCertsJSON))
+	}))
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	first, err := cache.Get(ts.Client())
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	second, err := cache.Get(ts.Client())
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 2 || notModified != 1 {
+		t.Errorf("got %d fetches, %d not modified\nwant 2 fetches, 1 not modified", fetches, notModified)
+	}
+	if first != second || len(second.Keys) != 2 {
+		t.Errorf("got %v\nwant the certs from the first fetch", second)
+	}
+}
+
+func TestCertCacheHeader(t *testing.T) {
+	const etag = `"1e9gdk7"`
+	document, err := json.Marshal(testCerts(t))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if r.Header.Get("X-Api-Key") != "proxy-secret" {
+			http.Error(w, "missing API key", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=0")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(document)
+	}))
+	defer ts.Close()
+	header := http.Header{"X-Api-Key": {"proxy-secret"}}
+
+	tests := []struct {
+		name     string
+		provider KeyProvider
+		expected error
+	}{
+		{"cache", &CertCache{Client: ts.Client(), URL: ts.URL, Header: header}, nil},
+		{"cache without header", &CertCache{Client: ts.Client(), URL: ts.URL}, ErrorCertsFetchFailed},
+		{"http", &HTTPKeyProvider{Client: ts.Client(), URL: ts.URL, Header: header}, nil},
+		{"http without header", &HTTPKeyProvider{Client: ts.Client(), URL: ts.URL}, ErrorCertsFetchFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&fetches, 0)
+			// The second fetch revalidates the cache's certs, and must still carry the header
+			for i := 0; i < 2; i++ {
+				_, err := tt.provider.GetCerts(context.Background())
+				if !errors.Is(err, tt.expected) {
+					t.Errorf("fetch %d: got %v\nwant %v", i, err, tt.expected)
+				}
+			}
+			if fetches != 2 {
+				t.Errorf("got %d fetches\nwant 2", fetches)
+			}
+		})
+	}
+	if len(header) != 1 {
+		t.Errorf("got %v\nwant the caller's header left unchanged", header)
+	}
+
+	if provider, ok := (VerifyOptions{CertsHeader: header}).keyProvider().(*HTTPKeyProvider); !ok || provider.Header.Get("X-Api-Key") != "proxy-secret" {
+		t.Errorf("got %v\nwant an HTTPKeyProvider sending CertsHeader", provider)
+	}
+}
+
+func TestCertCacheNotModifiedRefreshesExpiry(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fetches, 1)
+		w.Header().Set("ETag", `"v1"`)
+		if n == 1 {
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Write([]byte(googleCertsJSON))
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	for i := 0; i < 4; i++ {
+		if _, err := cache.Get(ts.Client()); err != nil {
+			t.Fatalf("got %v\nwant nil", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+}
+
+func TestVerifyWithOptionsRefetchesUnknownKeyID(t *testing.T) {
+	stale, err := json.Marshal(mustGetCerts(t, googleCertsJSON))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	rotated, err := json.Marshal(testCerts(t))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			w.Write(stale)
+			return
+		}
+		w.Write(rotated)
+	}))
+	defer ts.Close()
+
+	opts := VerifyOptions{Audiences: []string{testAud}, KeyProvider: &CertCache{Client: ts.Client(), URL: ts.URL, MinRefreshInterval: -1}}
+	authToken := signTestToken(t, nil, testClaims())
+	if _, err := VerifyWithOptions(context.Background(), authToken, opts); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+
+	if _, err := VerifyWithOptions(context.Background(), authToken, opts); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2 after the rotated certs were cached", fetches)
+	}
+}
+
+func TestVerifyWithOptionsRefetchesUnknownKeyIDOnce(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=3600", &fetches)
+	defer ts.Close()
+
+	opts := VerifyOptions{Audiences: []string{testAud}, KeyProvider: &CertCache{Client: ts.Client(), URL: ts.URL, MinRefreshInterval: -1}}
+	_, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts)
+	if !errors.Is(err, ErrorTokenInvalidKey) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+}
+
+func TestVerifyContextRefetchesUnknownKeyID(t *testing.T) {
+	stale, err := json.Marshal(mustGetCerts(t, googleCertsJSON))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	rotated, err := json.Marshal(testCerts(t))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			w.Write(stale)
+			return
+		}
+		w.Write(rotated)
+	}))
+	defer ts.Close()
+	saved := defaultCertCache
+	defer func() { defaultCertCache = saved }()
+
+	authToken := signTestToken(t, nil, testClaims())
+	verifiers := map[string]func() error{
+		"VerifyContext": func() error {
+			_, err := VerifyContext(context.Background(), authToken, testAud, ts.Client())
+			return err
+		},
+		"VerifyInto": func() error {
+			var claims struct{ Sub string }
+			return VerifyInto(context.Background(), authToken, testAud, &claims, ts.Client())
+		},
+	}
+	for name, verify := range verifiers {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&fetches, 0)
+			defaultCertCache = &CertCache{URL: ts.URL, MinRefreshInterval: -1}
+			if err := verify(); err != nil {
+				t.Fatalf("got %v\nwant nil", err)
+			}
+			if fetches != 2 {
+				t.Errorf("got %d fetches\nwant 2", fetches)
+			}
+		})
+	}
+}
+
+func TestCertCacheGetDeduplicatesConcurrentFetches(t *testing.T) {
+	var fetches int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(googleCertsJSON))
+	}))
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL}
+	const callers = 64
+	var wg sync.WaitGroup
+	results := make(chan *Certs, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			certs, err := cache.Get(ts.Client())
+			if err != nil {
+				t.Errorf("got %v\nwant nil", err)
+			}
+			results <- certs
+		}()
+	}
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+	first := <-results
+	for certs := range results {
+		if certs != first {
+			t.Errorf("got distinct certs\nwant every caller to share the single fetch")
+			break
+		}
+	}
+}
+
+func TestCertCacheGetWaitCanceled(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(googleCertsJSON))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	cache := &CertCache{URL: ts.URL}
+	go cache.Get(ts.Client())
+	for {
+		cache.mu.Lock()
+		inflight := cache.inflight != nil
+		cache.mu.Unlock()
+		if inflight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.GetCerts(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v\nwant %v", err, context.Canceled)
+	}
+}
+
+func TestCertCacheGetOwnerCanceled(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(googleCertsJSON))
+	}))
+	defer ts.Close()
+
+	cache := &CertCache{Client: ts.Client(), URL: ts.URL}
+	ctx, cancel := context.WithCancel(context.Background())
+	owner := make(chan error)
+	go func() {
+		_, err := cache.GetCerts(ctx)
+		owner <- err
+	}()
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waiter := make(chan error)
+	go func() {
+		_, err := cache.GetCerts(context.Background())
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-owner; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v\nwant %v", err, context.Canceled)
+	}
+	if err := <-waiter; err != nil {
+		t.Errorf("got %v\nwant nil for a waiter whose own context is live", err)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+}
+
+func TestCertCacheGetClientTimeoutShared(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	client := ts.Client()
+	client.Timeout = 100 * time.Millisecond
+	cache := &CertCache{Client: client, URL: ts.URL, Retry: RetryPolicy{MaxAttempts: 1}}
+	const callers = 8
+	errs := make(chan error, callers)
+	go func() {
+		_, err := cache.GetCerts(context.Background())
+		errs <- err
+	}()
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < callers; i++ {
+		go func() {
+			_, err := cache.GetCerts(context.Background())
+			errs <- err
+		}()
+	}
+	for i := 0; i < callers; i++ {
+		if err := <-errs; !errors.Is(err, ErrorCertsFetchFailed) {
+			t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+		}
+	}
+	// A client timeout is the endpoint failing, not the caller giving up, so waiters share it
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestCertCacheRefresh(t *testing.T) {
+	documents := []string{googleCertsJSON, `{"keys":[{"kty":"RSA","alg":"RS256","use":"sig","kid":"rotated","n":"AQAB","e":"AQAB"}]}`}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if int(n) <= len(documents) {
+			w.Write([]byte(documents[n-1]))
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cache := &CertCache{Client: ts.Client(), URL: ts.URL, Retry: RetryPolicy{MaxAttempts: 1}, MinRefreshInterval: -1}
+	certs, err := cache.GetCerts(context.Background())
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if len(certs.Keys) != 2 {
+		t.Fatalf("got %d keys\nwant 2", len(certs.Keys))
+	}
+
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	certs, err = cache.GetCerts(context.Background())
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if kids := certs.KeyIDs(); len(kids) != 1 || kids[0] != "rotated" {
+		t.Errorf("got %v\nwant [rotated]", kids)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+
+	if err := cache.Refresh(context.Background()); !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+	if certs, _ := cache.GetCerts(context.Background()); certs == nil || certs.KeyIDs()[0] != "rotated" {
+		t.Errorf("got %v\nwant the certs from the last successful refresh", certs)
+	}
+}
+
+func TestCertCacheMinRefreshInterval(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=3600", &fetches)
+	defer ts.Close()
+
+	cache := &CertCache{Client: ts.Client(), URL: ts.URL, MinRefreshInterval: time.Hour}
+	first, err := cache.GetCerts(context.Background())
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := cache.Refresh(context.Background()); err != nil {
+			t.Errorf("got %v\nwant nil", err)
+		}
+	}
+	// Each token naming an unknown kid forces a refresh, which must be throttled too
+	opts := VerifyOptions{Audiences: []string{testAud}, KeyProvider: cache}
+	for i := 0; i < 3; i++ {
+		if _, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts); !errors.Is(err, ErrorTokenInvalidKey) {
+			t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+	if certs, _ := cache.GetCerts(context.Background()); certs != first {
+		t.Errorf("got %v\nwant the cached certs", certs)
+	}
+
+	// The zero value throttles too, rather than refetching for every such token
+	cache = &CertCache{Client: ts.Client(), URL: ts.URL}
+	atomic.StoreInt32(&fetches, 0)
+	for i := 0; i < 20; i++ {
+		if _, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), VerifyOptions{Audiences: []string{testAud}, KeyProvider: cache}); !errors.Is(err, ErrorTokenInvalidKey) {
+			t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1 with the default interval", fetches)
+	}
+
+	cache = &CertCache{Client: ts.Client(), URL: ts.URL, MinRefreshInterval: 10 * time.Millisecond}
+	atomic.StoreInt32(&fetches, 0)
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2 once the interval has passed", fetches)
+	}
+}
+
+func TestCertCacheExpiresAt(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		expected     time.Duration
+	}{
+		{"public, max-age=19849, must-revalidate, no-transform", 19849 * time.Second},
+		{"max-age=3600", time.Hour},
+		{"MAX-AGE=60", time.Minute},
+		{"no-cache, max-age=3600", 0},
+		{"max-age=junk", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cacheControl, func(t *testing.T) {
+			var fetches int32
+			ts := newCertsServer(tt.cacheControl, &fetches)
+			defer ts.Close()
+
+			cache := &CertCache{URL: ts.URL}
+			if !cache.ExpiresAt().IsZero() {
+				t.Errorf("got %v\nwant the zero time before a fetch", cache.ExpiresAt())
+			}
+			before := time.Now()
+			if _, err := cache.Get(ts.Client()); err != nil {
+				t.Fatalf("got %v\nwant nil", err)
+			}
+			after := time.Now()
+			if actual := cache.ExpiresAt(); actual.Before(before.Add(tt.expected)) || actual.After(after.Add(tt.expected)) {
+				t.Errorf("got %v\nwant %v from now", actual.Sub(before), tt.expected)
+			}
+		})
+	}
+}
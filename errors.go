@@ -0,0 +1,120 @@
+package GoogleIdTokenVerifier
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// VerificationError is returned for a token whose header and claims could be decoded but which failed verification.
+// It carries the token's details for logging, and errors.Is matches the error it wraps.
+// KeyID, Issuer, Audience and Expiry are read from the token as presented and are unverified:
+// since it is also returned when the signature fails, they may come from a forged token and are attacker-controlled
+type VerificationError struct {
+	Err      error
+	KeyID    string
+	Issuer   string
+	Audience Audience
+	Expiry   time.Time
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%v (kid %q, iss %q, aud %q, exp %s)", e.Err, e.KeyID, e.Issuer, []string(e.Audience),
+		e.Expiry.UTC().Format(time.RFC3339))
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+func newVerificationError(err error, header *tokenHeader, tokeninfo *TokenInfo) error {
+	return &VerificationError{Err: err, KeyID: header.Kid, Issuer: tokeninfo.Iss, Audience: tokeninfo.Aud, Expiry: tokeninfo.Exp.Time()}
+}
+
+// The constructors below add the offending values to a sentinel error.
+// errors.Is still matches the sentinel they wrap
+
+func newAudienceError(got Audience, want []string) error {
+	return fmt.Errorf("%w: got %q, want one of %q", ErrorTokenInvalidAudience, []string(got), want)
+}
+
+// newMissingAudienceError also wraps ErrorTokenInvalidAudience, which a missing aud was reported as before
+func newMissingAudienceError() error {
+	return fmt.Errorf("%w: %w", ErrorTokenMissingAudience, ErrorTokenInvalidAudience)
+}
+
+func newIssuerError(got string, want []string) error {
+	return fmt.Errorf("%w: got %q, want one of %q", ErrorTokenInvalidISS, got, want)
+}
+
+func newAzpError(got, want string) error {
+	return fmt.Errorf("%w: got %q, want %q", ErrorTokenInvalidAZP, got, want)
+}
+
+func newHostedDomainError(got, want string) error {
+	return fmt.Errorf("%w: got %q, want %q", ErrorTokenInvalidHostedDomain, got, want)
+}
+
+func newEmailDomainError(got string, want []string) error {
+	return fmt.Errorf("%w: got %q, want one of %q", ErrorTokenEmailNotAllowed, maskEmail(got), want)
+}
+
+func newExpiredError(tokeninfo *TokenInfo) error {
+	return fmt.Errorf("%w: iat %s, exp %s", ErrorTokenExpired,
+		tokeninfo.Iat.Time().UTC().Format(time.RFC3339), tokeninfo.Exp.Time().UTC().Format(time.RFC3339))
+}
+
+func newUsedBeforeIssuedError(tokeninfo *TokenInfo) error {
+	return fmt.Errorf("%w: iat %s", ErrorTokenUsedBeforeIssued, tokeninfo.Iat.Time().UTC().Format(time.RFC3339))
+}
+
+func newKeyError(kid string) error {
+	return fmt.Errorf("%w: kid %q", ErrorTokenInvalidKey, kid)
+}
+
+func newAlgorithmError(alg string) error {
+	return fmt.Errorf("%w: %q", ErrorTokenUnsupportedAlgorithm, alg)
+}
+
+func newFetchError(err error) error {
+	return fmt.Errorf("%w: %w", ErrorCertsFetchFailed, err)
+}
+
+// tokenErrors are the errors caused by the token or the request carrying it
+var tokenErrors = []error{
+	ErrorTokenInvalidAudience, ErrorTokenMissingAudience, ErrorTokenInvalidISS, ErrorTokenExpired,
+	ErrorTokenUsedBeforeIssued, ErrorTokenNotYetValid, ErrorTokenInvalidAZP, ErrorTokenInvalidHostedDomain,
+	ErrorTokenInvalidNonce, ErrorTokenInvalidAtHash, ErrorTokenMissingSubject, ErrorTokenEmailNotVerified,
+	ErrorTokenEmailNotAllowed, ErrorTokenMissingKeyID, ErrorTokenInvalidKey, ErrorTokenInvalidType,
+	ErrorTokenUnsupportedAlgorithm, ErrorTokenAlgorithmMismatch, ErrorTokenKeyNotAllowed, ErrorTokenSignatureInvalid,
+	ErrorTokenMalformedSignature, ErrorTokenTooLarge, ErrorTokenMalformed, ErrorTokenMalformedHeader,
+	ErrorTokenMalformedPayload, ErrorOAuth2TokenMissingIDToken, ErrorAuthHeaderMissing, ErrorAuthHeaderMalformed,
+}
+
+// fetchErrors are the errors caused by getting or parsing the certs
+var fetchErrors = []error{
+	ErrorCertsFetchFailed, ErrorCertsFetchInvalid, ErrorCertsMalformed, ErrorCertsDuplicateKeyID,
+	ErrorWeakSigningKey, ErrorCertsInvalidPEM, ErrorCertsMissingKeyID,
+}
+
+// IsTokenError reports whether err is the client's fault: the token is malformed, expired, wrongly signed or
+// otherwise unacceptable, so the request should be answered with 401 Unauthorized
+func IsTokenError(err error) bool {
+	return !IsFetchError(err) && isAny(err, tokenErrors)
+}
+
+// IsFetchError reports whether err is ours: the certs couldn't be fetched or weren't usable, so the token
+// couldn't be checked at all and the request should be answered with 503 Service Unavailable, to be retried.
+// Errors that are neither, such as from a custom KeyProvider, are best treated as 500 Internal Server Error
+func IsFetchError(err error) bool {
+	return isAny(err, fetchErrors)
+}
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package GoogleIdTokenVerifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrappedErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		sentinel error
+		contains string
+	}{
+		{"audience", newAudienceError(Audience{"got.apps.googleusercontent.com"}, []string{testAud}), ErrorTokenInvalidAudience, "got.apps.googleusercontent.com"},
+		{"issuer", newIssuerError("https://example.com", googleIssuers), ErrorTokenInvalidISS, "https://example.com"},
+		{"azp", newAzpError("got", "want"), ErrorTokenInvalidAZP, `got "got", want "want"`},
+		{"hosted domain", newHostedDomainError("example.org", "example.com"), ErrorTokenInvalidHostedDomain, "example.org"},
+		{"email domain", newEmailDomainError("testuser@gmail.com", []string{"example.com"}), ErrorTokenEmailNotAllowed, `got "t...@gmail.com"`},
+		{"expired", newExpiredError(&TokenInfo{Iat: 1500000000, Exp: 1500003600}), ErrorTokenExpired, "2017-07-14T03:40:00Z"},
+		{"used before issued", newUsedBeforeIssuedError(&TokenInfo{Iat: 1500000000}), ErrorTokenUsedBeforeIssued, "2017-07-14T02:40:00Z"},
+		{"key", newKeyError("unknown-kid"), ErrorTokenInvalidKey, "unknown-kid"},
+		{"algorithm", newAlgorithmError("HS256"), ErrorTokenUnsupportedAlgorithm, "HS256"},
+		{"fetch", newFetchError(errors.New("connection refused")), ErrorCertsFetchFailed, "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.sentinel) {
+				t.Errorf("got %v\nwant %v", tt.err, tt.sentinel)
+			}
+			if !strings.Contains(tt.err.Error(), tt.contains) {
+				t.Errorf("got %q\nwant it to contain %q", tt.err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestVerifyWrappedErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   func(map[string]interface{})
+		header   map[string]interface{}
+		sentinel error
+	}{
+		{"audience", func(c map[string]interface{}) { c["aud"] = "other" }, nil, ErrorTokenInvalidAudience},
+		{"issuer", func(c map[string]interface{}) { c["iss"] = "https://example.com" }, nil, ErrorTokenInvalidISS},
+		{"expired", func(c map[string]interface{}) { c["exp"] = int64(1500003600) }, nil, ErrorTokenExpired},
+		{"key", nil, map[string]interface{}{"alg": "RS256", "kid": "unknown-kid"}, ErrorTokenInvalidKey},
+		{"algorithm", nil, map[string]interface{}{"alg": "HS256", "kid": testKeyID}, ErrorTokenUnsupportedAlgorithm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			_, err := VerifyGoogleIDToken(signTestToken(t, tt.header, claims), testCerts(t), testAud)
+			if !errors.Is(err, tt.sentinel) {
+				t.Errorf("got %v\nwant %v", err, tt.sentinel)
+			}
+		})
+	}
+}
+
+func TestVerificationError(t *testing.T) {
+	claims := testClaims()
+	claims["aud"] = "other.apps.googleusercontent.com"
+	claims["exp"] = int64(1800000000)
+	_, err := VerifyGoogleIDToken(signTestToken(t, nil, claims), testCerts(t), testAud)
+
+	var verr *VerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %T\nwant *VerificationError", err)
+	}
+	if !errors.Is(err, ErrorTokenInvalidAudience) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+	}
+	expected := VerificationError{
+		Err:      verr.Err,
+		KeyID:    testKeyID,
+		Issuer:   "https://accounts.google.com",
+		Audience: Audience{"other.apps.googleusercontent.com"},
+		Expiry:   time.Unix(1800000000, 0),
+	}
+	if !reflect.DeepEqual(*verr, expected) {
+		t.Errorf("got %+v\nwant %+v", *verr, expected)
+	}
+	for _, detail := range []string{"other.apps.googleusercontent.com", testAud, `kid "1e9gdk7"`, "2027-01-15T08:00:00Z"} {
+		if !strings.Contains(err.Error(), detail) {
+			t.Errorf("got %q\nwant it to contain %q", err, detail)
+		}
+	}
+}
+
+func TestVerificationErrorUndecodedToken(t *testing.T) {
+	var verr *VerificationError
+	if _, err := VerifyGoogleIDToken("XXX", testCerts(t), testAud); errors.As(err, &verr) {
+		t.Errorf("got %v\nwant the bare sentinel for a token that can't be decoded", verr)
+	}
+}
+
+func TestIsTokenErrorIsFetchError(t *testing.T) {
+	expired := testClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, expiredErr := VerifyGoogleIDToken(signTestToken(t, nil, expired), testCerts(t), testAud)
+	_, forgedErr := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), mustGetCerts(t, googleCertsJSON), testAud)
+	unreachable := &HTTPKeyProvider{Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("dial tcp: no route to host")
+	})}, Retry: RetryPolicy{MaxAttempts: 1}}
+	_, unreachableErr := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), VerifyOptions{Audiences: []string{testAud}, KeyProvider: unreachable})
+	weak := testCerts(t)
+	weak.Keys[0].N = base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{0xff}, 128))
+	_, weakErr := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), weak, testAud)
+	_, headerErr := TokenFromAuthHeader("Basic dXNlcjpwYXNz")
+
+	tests := []struct {
+		name  string
+		err   error
+		token bool
+		fetch bool
+	}{
+		{"nil", nil, false, false},
+		{"expired", expiredErr, true, false},
+		{"unknown kid", forgedErr, true, false},
+		{"malformed", ErrorTokenMalformed, true, false},
+		{"auth header", headerErr, true, false},
+		{"missing id token", ErrorOAuth2TokenMissingIDToken, true, false},
+		{"unreachable", unreachableErr, false, true},
+		{"weak key", weakErr, false, true},
+		{"malformed certs", ErrorCertsMalformed, false, true},
+		{"duplicate kid", ErrorCertsDuplicateKeyID, false, true},
+		{"invalid PEM", ErrorCertsInvalidPEM, false, true},
+		{"key provider", errors.New("redis: connection refused"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := IsTokenError(tt.err); actual != tt.token {
+				t.Errorf("%v: got IsTokenError %v\nwant %v", tt.err, actual, tt.token)
+			}
+			if actual := IsFetchError(tt.err); actual != tt.fetch {
+				t.Errorf("%v: got IsFetchError %v\nwant %v", tt.err, actual, tt.fetch)
+			}
+		})
+	}
+
+	for _, err := range tokenErrors {
+		if !IsTokenError(err) || IsFetchError(err) {
+			t.Errorf("%v: got token %v, fetch %v\nwant a token error", err, IsTokenError(err), IsFetchError(err))
+		}
+	}
+	for _, err := range fetchErrors {
+		if IsTokenError(err) || !IsFetchError(err) {
+			t.Errorf("%v: got token %v, fetch %v\nwant a fetch error", err, IsTokenError(err), IsFetchError(err))
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// firebaseCertsURL serves the keys Firebase Authentication signs ID tokens with, as a kid -> PEM certificate map
+const firebaseCertsURL = "https://www.googleapis.com/service_accounts/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+// firebaseIssuerPrefix is followed by the project ID in a Firebase ID token's issuer
+const firebaseIssuerPrefix = "https://securetoken.google.com/"
+
+// firebaseCertCache backs VerifyFirebaseToken. Firebase's keys are separate from those of Google Sign-In
+var firebaseCertCache = &CertCache{URL: firebaseCertsURL, parse: parseX509Certs}
+
+// VerifyFirebaseToken verifies a Firebase Authentication ID token issued for the Firebase project projectID.
+// Besides the signature and expiry, the token's aud must be projectID, its iss must name the project,
+// and its sub must be the non-empty uid of the user. If client is nil, http.DefaultClient is used.
+// The certs are cached until they expire
+func VerifyFirebaseToken(ctx context.Context, authToken string, projectID string, client *http.Client) (*TokenInfo, error) {
+	return verifyFirebaseToken(ctx, authToken, projectID, clientCertCache{firebaseCertCache, client})
+}
+
+func verifyFirebaseToken(ctx context.Context, authToken string, projectID string, provider KeyProvider) (*TokenInfo, error) {
+	if projectID == "" {
+		return nil, fmt.Errorf("%w: project ID is empty", ErrorTokenInvalidAudience)
+	}
+	return VerifyWithOptions(ctx, authToken, VerifyOptions{
+		Audiences:       []string{projectID},
+		ExpectedIssuers: []string{firebaseIssuerPrefix + projectID},
+		RequireSubject:  true,
+		KeyProvider:     provider,
+	})
+}
@@ -0,0 +1,142 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testProjectID = "talkative-test"
+
+// testFirebaseClaims returns claims shaped like those Firebase Authentication issues for testProjectID
+func testFirebaseClaims() map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":       "https://securetoken.google.com/" + testProjectID,
+		"aud":       testProjectID,
+		"auth_time": now,
+		"user_id":   "kXBoLpWgQFe3gXnNAi9ysMcJixV2",
+		"sub":       "kXBoLpWgQFe3gXnNAi9ysMcJixV2",
+		"iat":       now,
+		"exp":       now + 3600,
+		"email":     "testuser@gmail.com",
+		"firebase": map[string]interface{}{
+			"identities":       map[string]interface{}{"email": []string{"testuser@gmail.com"}},
+			"sign_in_provider": "password",
+		},
+	}
+}
+
+func TestVerifyFirebaseToken(t *testing.T) {
+	bt, err := json.Marshal(map[string]string{testKeyID: testCertificatePEM(t)})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var requested string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requested = r.URL.String()
+		rec := httptest.NewRecorder()
+		rec.Write(bt)
+		return rec.Result(), nil
+	})}
+
+	actual, err := VerifyFirebaseToken(context.Background(), signTestToken(t, nil, testFirebaseClaims()), testProjectID, client)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if requested != firebaseCertsURL {
+		t.Errorf("got %v\nwant %v", requested, firebaseCertsURL)
+	}
+	if actual.Sub != "kXBoLpWgQFe3gXnNAi9ysMcJixV2" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "kXBoLpWgQFe3gXnNAi9ysMcJixV2")
+	}
+	if _, ok := actual.Claims["firebase"]; !ok {
+		t.Errorf("got %v\nwant the firebase claim in Claims", actual.Claims)
+	}
+}
+
+func TestVerifyFirebaseTokenCachesCerts(t *testing.T) {
+	bt, err := json.Marshal(map[string]string{testKeyID: testCertificatePEM(t)})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(bt)
+	}))
+	defer ts.Close()
+	saved := firebaseCertCache
+	firebaseCertCache = &CertCache{URL: ts.URL, parse: parseX509Certs}
+	defer func() { firebaseCertCache = saved }()
+
+	for i := 0; i < 2; i++ {
+		if _, err := VerifyFirebaseToken(context.Background(), signTestToken(t, nil, testFirebaseClaims()), testProjectID, ts.Client()); err != nil {
+			t.Fatalf("got %v\nwant nil", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestVerifyFirebaseTokenRefetchesUnknownKeyID(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kid := testKeyID
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			kid = "retired"
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(map[string]string{kid: testCertificatePEM(t)})
+	}))
+	defer ts.Close()
+	saved := firebaseCertCache
+	firebaseCertCache = &CertCache{URL: ts.URL, MinRefreshInterval: -1, parse: parseX509Certs}
+	defer func() { firebaseCertCache = saved }()
+
+	if _, err := VerifyFirebaseToken(context.Background(), signTestToken(t, nil, testFirebaseClaims()), testProjectID, ts.Client()); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches\nwant 2", fetches)
+	}
+}
+
+func TestVerifyFirebaseTokenClaims(t *testing.T) {
+	certs := testCerts(t)
+	tests := []struct {
+		name      string
+		claims    func(map[string]interface{})
+		projectID string
+		expected  error
+	}{
+		{"valid", nil, testProjectID, nil},
+		{"other project", nil, "other-project", ErrorTokenInvalidAudience},
+		{"empty project", nil, "", ErrorTokenInvalidAudience},
+		{"audience", func(c map[string]interface{}) { c["aud"] = "other-project" }, testProjectID, ErrorTokenInvalidAudience},
+		{"google issuer", func(c map[string]interface{}) { c["iss"] = "https://accounts.google.com" }, testProjectID, ErrorTokenInvalidISS},
+		{"other project issuer", func(c map[string]interface{}) { c["iss"] = "https://securetoken.google.com/other-project" }, testProjectID, ErrorTokenInvalidISS},
+		{"empty subject", func(c map[string]interface{}) { c["sub"] = "" }, testProjectID, ErrorTokenMissingSubject},
+		{"missing subject", func(c map[string]interface{}) { delete(c, "sub") }, testProjectID, ErrorTokenMissingSubject},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, testProjectID, ErrorTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testFirebaseClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			_, err := verifyFirebaseToken(context.Background(), signTestToken(t, nil, claims), tt.projectID, &StaticKeyProvider{Certs: certs})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
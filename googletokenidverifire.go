@@ -2,178 +2,1030 @@ package GoogleIdTokenVerifier
 
 import (
 	"bytes"
+	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
-	"crypto/sha256"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"math"
 	"math/big"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
-// Certs is
+// googleCertsURL is the JWKS endpoint serving Google's ID token signing keys
+const googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// Certs is a JSON Web Key Set, the keys a token's signature may be checked against.
+// It is usually parsed from a JWKS document with GetCerts, but may be built from Keys directly
 type Certs struct {
-	Keys []keys `json:"keys"`
+	Keys []Key `json:"keys"`
+
+	// publicKeys holds Keys parsed once, on first use. Keys must not be modified after that
+	once       sync.Once
+	publicKeys map[string]crypto.PublicKey
+}
+
+// publicKey returns the parsed public key for kid
+func (c *Certs) publicKey(kid string) (crypto.PublicKey, error) {
+	c.once.Do(c.parseKeys)
+	if pub, ok := c.publicKeys[kid]; ok {
+		return pub, nil
+	}
+	key, err := choiceKeyByKeyID(c.Keys, kid)
+	if err != nil {
+		return nil, err
+	}
+	return parsePublicKey(key)
+}
+
+// KeyIDs returns the kid of each key, in document order
+func (c *Certs) KeyIDs() []string {
+	kids := make([]string, 0, len(c.Keys))
+	for _, key := range c.Keys {
+		kids = append(kids, key.Kid)
+	}
+	return kids
+}
+
+// parseKeys parses each usable key up front. Keys of a type we can't verify with, such as OKP or oct,
+// are skipped rather than parsed as RSA, so one can share a kid with a usable key
+func (c *Certs) parseKeys() {
+	c.publicKeys = make(map[string]crypto.PublicKey, len(c.Keys))
+	for i := range c.Keys {
+		if _, ok := c.publicKeys[c.Keys[i].Kid]; ok || !c.Keys[i].supported() {
+			continue
+		}
+		if pub, err := parsePublicKey(&c.Keys[i]); err == nil {
+			c.publicKeys[c.Keys[i].Kid] = pub
+		}
+	}
+}
+
+// supported reports whether key is of a type parsePublicKey can verify with
+func (key *Key) supported() bool {
+	return key.Kty == "RSA" || key.Kty == "EC" && key.Crv == "P-256"
 }
 
-type keys struct {
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Key is a JSON Web Key, one entry in Certs. Binary values are base64url encoded without padding
+type Key struct {
+	// Kty is the key type, RSA or EC
 	Kty string `json:"kty"`
+	// Alg is the algorithm the key signs with, such as RS256 or ES256
 	Alg string `json:"alg"`
+	// Use is the intended use of the key, sig for signing
 	Use string `json:"use"`
-	Kid string `json:"Kid"`
-	N   string `json:"n"`
-	E   string `json:"e"`
+	// Kid identifies the key, and is matched against the kid in a token's header
+	Kid string `json:"kid"`
+	// N is the modulus of an RSA key
+	N string `json:"n,omitempty"`
+	// E is the public exponent of an RSA key
+	E string `json:"e,omitempty"`
+	// Crv is the curve of an EC key, P-256
+	Crv string `json:"crv,omitempty"`
+	// X is the x coordinate of an EC key
+	X string `json:"x,omitempty"`
+	// Y is the y coordinate of an EC key
+	Y string `json:"y,omitempty"`
 }
 
 // TokenInfo is
 type TokenInfo struct {
-	Sub           string `json:"sub"`
-	Email         string `json:"email"`
-	AtHash        string `json:"at_hash"`
-	Aud           string `json:"aud"`
-	EmailVerified bool   `json:"email_verified"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
-	Local         string `json:"locale"`
-	Iss           string `json:"iss"`
-	Azp           string `json:"azp"`
-	Iat           int64  `json:"iat"`
-	Exp           int64  `json:"exp"`
+	Sub           string      `json:"sub"`
+	Email         string      `json:"email"`
+	AtHash        string      `json:"at_hash"`
+	Aud           Audience    `json:"aud"`
+	EmailVerified BoolClaim   `json:"email_verified"`
+	Name          string      `json:"name"`
+	GivenName     string      `json:"given_name"`
+	FamilyName    string      `json:"family_name"`
+	Picture       string      `json:"picture"`
+	Profile       string      `json:"profile"`
+	Locale        string      `json:"locale"`
+	Iss           string      `json:"iss"`
+	Azp           string      `json:"azp"`
+	Hd            string      `json:"hd"`
+	Nonce         string      `json:"nonce"`
+	Iat           NumericDate `json:"iat"`
+	Exp           NumericDate `json:"exp"`
+	Nbf           NumericDate `json:"nbf"`
+	// Claims holds every claim from the payload, including ones without a field above
+	Claims map[string]interface{} `json:"-"`
+}
+
+// ExpiresIn returns how long the token remains valid, which is negative once it has expired
+func (tokeninfo *TokenInfo) ExpiresIn() time.Duration {
+	return time.Until(tokeninfo.Exp.Time())
+}
+
+// String returns a redacted summary of the token for logs, with the subject shortened and the email masked.
+// It has a value receiver so that %v and %+v print the summary for a TokenInfo, a pointer to one,
+// or a struct embedding one, rather than the user's email, name and picture URL
+func (tokeninfo TokenInfo) String() string {
+	return fmt.Sprintf("TokenInfo{sub: %s, email: %s, iss: %s, exp: %s}", redact(tokeninfo.Sub, 4),
+		maskEmail(tokeninfo.Email), tokeninfo.Iss, tokeninfo.Exp.Time().UTC().Format(time.RFC3339))
+}
+
+// redact keeps the first n characters of s
+func redact(s string, n int) string {
+	if len(s) <= n {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:n] + "..."
+}
+
+// maskEmail keeps the first character of the local part and the domain
+func maskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return redact(email, 0)
+	}
+	return redact(email[:at], 1) + email[at:]
+}
+
+// IsExpired reports whether the token's exp has passed
+func (tokeninfo *TokenInfo) IsExpired() bool {
+	return time.Now().After(tokeninfo.Exp.Time())
+}
+
+// Valid re-runs the checks on exp, iat and nbf as of now, without leeway, for a TokenInfo verified earlier and since stored.
+// It returns ErrorTokenNotYetValid, ErrorTokenUsedBeforeIssued or ErrorTokenExpired, like the verification it repeats
+func (tokeninfo *TokenInfo) Valid(now time.Time) error {
+	return validateTimes(tokeninfo, VerifyOptions{Now: func() time.Time { return now }})
+}
+
+// Audiences returns the aud claim as a slice, whether the token encoded it as a single string or an array.
+// The slice is a copy, so callers may modify it
+func (tokeninfo *TokenInfo) Audiences() []string {
+	return append([]string(nil), tokeninfo.Aud...)
+}
+
+// Audience is the aud claim, which may be encoded as either a single string or an array of strings
+type Audience []string
+
+// UnmarshalJSON accepts both the string and the array form of aud
+func (a *Audience) UnmarshalJSON(bt []byte) error {
+	var single string
+	if err := json.Unmarshal(bt, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(bt, &multiple); err != nil {
+		return err
+	}
+	*a = Audience(multiple)
+	return nil
+}
+
+// MarshalJSON encodes a single audience as a string, as Google does
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// NumericDate is a date claim in seconds since the Unix epoch, encoded as either a JSON number or a numeric string
+type NumericDate int64
+
+// UnmarshalJSON accepts both the number and the string form of a date claim
+func (d *NumericDate) UnmarshalJSON(bt []byte) error {
+	var n json.Number
+	if len(bt) > 0 && bt[0] == '"' {
+		var str string
+		if err := json.Unmarshal(bt, &str); err != nil {
+			return err
+		}
+		n = json.Number(strings.TrimSpace(str))
+	} else if err := json.Unmarshal(bt, &n); err != nil {
+		return err
+	}
+	if i, err := n.Int64(); err == nil {
+		*d = NumericDate(i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	// Converting a float beyond int64 is undefined, and in practice wraps to a date in the distant past
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return fmt.Errorf("date %s is out of range", n)
+	}
+	*d = NumericDate(f)
+	return nil
+}
+
+// Time returns d as a time.Time
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// BoolClaim is a boolean claim, encoded as either a JSON boolean or, by some providers, the string "true" or "false"
+type BoolClaim bool
+
+// UnmarshalJSON accepts both the boolean and the string form of a boolean claim
+func (b *BoolClaim) UnmarshalJSON(bt []byte) error {
+	if len(bt) > 0 && bt[0] == '"' {
+		var str string
+		if err := json.Unmarshal(bt, &str); err != nil {
+			return err
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return err
+		}
+		*b = BoolClaim(v)
+		return nil
+	}
+	var v bool
+	if err := json.Unmarshal(bt, &v); err != nil {
+		return err
+	}
+	*b = BoolClaim(v)
+	return nil
 }
 
 var (
-	ErrorTokenInvalidAudience error = errors.New("Token is not valid, Audience from token and certificate don't match")
-	ErrorTokenInvalidISS      error = errors.New("Token is not valid, ISS from token and certificate don't match")
-	ErrorTokenExpired         error = errors.New("Token is not valid, Token is expired")
-	ErrorTokenInvalidKey      error = errors.New("Token is not valid, KeyID from token and certificate don't match")
+	ErrorTokenInvalidAudience      error = errors.New("Token is not valid, Audience from token and certificate don't match")
+	ErrorTokenMissingAudience      error = errors.New("Token is not valid, Audience is missing, so it may not be an ID token")
+	ErrorTokenInvalidISS           error = errors.New("Token is not valid, ISS from token and certificate don't match")
+	ErrorTokenExpired              error = errors.New("Token is not valid, Token is expired")
+	ErrorTokenUsedBeforeIssued     error = errors.New("Token is not valid, Token is used before its iat time")
+	ErrorTokenNotYetValid          error = errors.New("Token is not valid, Token is not valid before its nbf time")
+	ErrorTokenInvalidAZP           error = errors.New("Token is not valid, AZP from token and expected authorized party don't match")
+	ErrorTokenInvalidHostedDomain  error = errors.New("Token is not valid, HD from token and expected hosted domain don't match")
+	ErrorTokenInvalidNonce         error = errors.New("Token is not valid, Nonce from token and expected nonce don't match")
+	ErrorTokenInvalidAtHash        error = errors.New("Token is not valid, AtHash from token and access token don't match")
+	ErrorTokenMissingSubject       error = errors.New("Token is not valid, Subject from token is empty")
+	ErrorTokenEmailNotVerified     error = errors.New("Token is not valid, Email from token is not verified")
+	ErrorTokenEmailNotAllowed      error = errors.New("Token is not valid, Email from token is not in an allowed domain")
+	ErrorTokenMissingKeyID         error = errors.New("Token is not valid, Header has no KeyID")
+	ErrorTokenInvalidKey           error = errors.New("Token is not valid, KeyID from token and certificate don't match")
+	ErrorTokenInvalidType          error = errors.New("Token is not valid, Type from token header is not JWT")
+	ErrorTokenUnsupportedAlgorithm error = errors.New("Token is not valid, Algorithm from token header is not supported")
+	ErrorTokenAlgorithmMismatch    error = errors.New("Token is not valid, Algorithm from token header and key don't match")
+	ErrorTokenKeyNotAllowed        error = errors.New("Token is not valid, Signing key is not one of the pinned keys")
+	ErrorTokenSignatureInvalid     error = errors.New("Token is not valid, Signature doesn't match the signing key")
+	ErrorTokenMalformedSignature   error = errors.New("Token is not valid, Signature length doesn't match the signing key")
+	ErrorTokenTooLarge             error = errors.New("Token is not valid, Token exceeds the maximum size")
+	ErrorTokenMalformed            error = errors.New("Token is not valid, Token must consist of three dot-separated parts")
+	ErrorTokenMalformedHeader      error = errors.New("Token is not valid, Header is not a JSON object")
+	ErrorTokenMalformedPayload     error = errors.New("Token is not valid, Payload is not a JSON object")
+	ErrorWeakSigningKey            error = errors.New("Certs are not valid, RSA key is shorter than 2048 bits")
+	ErrorCertsMalformed            error = errors.New("Certs are not valid, JWKS document could not be parsed")
+	ErrorCertsDuplicateKeyID       error = errors.New("Certs are not valid, two keys have the same kid")
+	ErrorCertsFetchInvalid         error = errors.New("Certs are not valid, the cert endpoint's response is not a cert document")
+	ErrorCertsFetchFailed          error = errors.New("Certs could not be fetched from the cert endpoint")
 )
 
 // Verify accepts an auth token, a Google app Client ID, and an optional http client override
-// If the token is valid, TokenInfo is returned. Otherwise, a null pointer and an error are returned
+// If the token is valid, TokenInfo is returned. Otherwise, a null pointer and an error are returned.
+// Google's certs are cached between calls
 func Verify(authToken string, aud string, client *http.Client) (*TokenInfo, error) {
-	var _client *http.Client
-	if client == nil {
-		_client = http.DefaultClient
-	} else {
-		_client = client
+	return VerifyContext(context.Background(), authToken, aud, client)
+}
+
+// MustVerify is like Verify but panics if the token can't be verified.
+// It is meant for scripts and test setup, not for verifying tokens from requests
+func MustVerify(authToken string, aud string, client *http.Client) *TokenInfo {
+	tokeninfo, err := Verify(authToken, aud, client)
+	if err != nil {
+		panic(err)
+	}
+	return tokeninfo
+}
+
+// VerifyContext is like Verify, but the certificate fetch is bound to ctx
+// so that cancellation and deadlines are respected.
+// Certs are shared by all callers and only refetched once Google's max-age has elapsed,
+// or when a token names a kid they lack
+func VerifyContext(ctx context.Context, authToken string, aud string, client *http.Client) (*TokenInfo, error) {
+	return VerifyWithOptions(ctx, authToken, VerifyOptions{Audiences: []string{aud}, KeyProvider: clientCertCache{defaultCertCache, client}})
+}
+
+// VerifyInto is like VerifyContext, but rather than returning a TokenInfo it unmarshals the verified payload
+// into dest, a pointer to a struct with fields for the claims the caller needs, including provider-specific ones.
+// An error unmarshalling into dest, such as for a dest that isn't a pointer, is returned as is rather than as a token error
+func VerifyInto(ctx context.Context, authToken string, aud string, dest interface{}, client *http.Client) error {
+	return verifyInto(ctx, authToken, aud, dest, clientCertCache{defaultCertCache, client})
+}
+
+func verifyInto(ctx context.Context, authToken string, aud string, dest interface{}, provider KeyProvider) error {
+	_, payload, err := verifyWithProvider(ctx, authToken, VerifyOptions{Audiences: []string{aud}, KeyProvider: provider})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, dest)
+}
+
+// VerifyReader is like VerifyContext, reading the token from r. Surrounding whitespace is ignored.
+// At most 8KB is read, so that a client can't exhaust memory by streaming an oversized token
+func VerifyReader(ctx context.Context, r io.Reader, aud string, client *http.Client) (*TokenInfo, error) {
+	bt, err := io.ReadAll(io.LimitReader(r, defaultMaxTokenSize+1))
+	if err != nil {
+		return nil, err
 	}
-	return VerifyGoogleIDToken(authToken, GetCerts(GetCertsFromURL(_client)), aud)
+	if len(bt) > defaultMaxTokenSize {
+		return nil, ErrorTokenTooLarge
+	}
+	return VerifyContext(ctx, strings.TrimSpace(string(bt)), aud, client)
 }
 
+// VerifyGoogleIDToken verifies authToken against certs for the Client ID aud
 func VerifyGoogleIDToken(authToken string, certs *Certs, aud string) (*TokenInfo, error) {
-	header, payload, signature, messageToSign := divideAuthToken(authToken)
+	return VerifyGoogleIDTokenWithOptions(authToken, certs, aud, VerifyOptions{})
+}
+
+// VerifyGoogleIDTokenWithOptions is like VerifyGoogleIDToken, with the checks adjusted by opts.
+// aud is accepted in addition to opts.Audiences
+func VerifyGoogleIDTokenWithOptions(authToken string, certs *Certs, aud string, opts VerifyOptions) (*TokenInfo, error) {
+	if aud != "" {
+		opts.Audiences = append([]string{aud}, opts.Audiences...)
+	}
+	tokeninfo, err := verifyGoogleIDToken(authToken, certs, opts)
+	opts.report(err)
+	return tokeninfo, err
+}
+
+// VerifyGoogleIDTokenWithPayload is like VerifyGoogleIDToken, also returning the token's payload: the exact
+// JSON bytes that were signed, decoded from base64url, for callers that hash or store them
+func VerifyGoogleIDTokenWithPayload(authToken string, certs *Certs, aud string) (*TokenInfo, []byte, error) {
+	return verifyGoogleIDTokenPayload(authToken, certs, VerifyOptions{Audiences: []string{aud}})
+}
+
+// VerifyDetailed is like VerifyGoogleIDToken, also returning the kid of the key in certs that verified the token,
+// for audit logs and for monitoring key rotation
+func VerifyDetailed(authToken string, certs *Certs, aud string) (*TokenInfo, string, error) {
+	tokeninfo, err := VerifyGoogleIDToken(authToken, certs, aud)
+	if err != nil {
+		return nil, "", err
+	}
+	// The signature has been checked against the key the header names, so the header parses
+	kid, err := KeyID(authToken)
+	if err != nil {
+		return nil, "", err
+	}
+	return tokeninfo, kid, nil
+}
+
+// VerifyWithCertBytes is like VerifyGoogleIDToken, but takes the raw JWKS document,
+// for callers that already hold Google's certs and want to avoid any network call
+func VerifyWithCertBytes(authToken string, aud string, certBytes []byte) (*TokenInfo, error) {
+	certs, err := GetCerts(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyGoogleIDToken(authToken, certs, aud)
+}
+
+// VerifyWithAudiences is like VerifyGoogleIDToken, but accepts a token issued to any of auds
+func VerifyWithAudiences(authToken string, certs *Certs, auds []string) (*TokenInfo, error) {
+	return verifyGoogleIDToken(authToken, certs, VerifyOptions{Audiences: auds})
+}
+
+func verifyGoogleIDToken(authToken string, certs *Certs, opts VerifyOptions) (*TokenInfo, error) {
+	tokeninfo, _, err := verifyGoogleIDTokenPayload(authToken, certs, opts)
+	return tokeninfo, err
+}
+
+// verifyGoogleIDTokenPayload is verifyGoogleIDToken, also returning the decoded payload the TokenInfo was parsed from
+func verifyGoogleIDTokenPayload(authToken string, certs *Certs, opts VerifyOptions) (*TokenInfo, []byte, error) {
+	if len(authToken) > opts.maxTokenSize() {
+		return nil, nil, ErrorTokenTooLarge
+	}
+	bt, payload, signature, messageToSign, err := divideAuthToken(authToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := getAuthTokenHeader(bt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Kid == "" {
+		return nil, nil, ErrorTokenMissingKeyID
+	}
+	if err := checkAlgorithm(header.Alg); err != nil {
+		return nil, nil, err
+	}
+	// typ is a media type, so it is compared case-insensitively
+	if opts.RequireJWTType && header.Typ != "" && !strings.EqualFold(header.Typ, "JWT") {
+		return nil, nil, ErrorTokenInvalidType
+	}
+
+	tokeninfo, err := getTokenInfo(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkClaims(tokeninfo, opts); err != nil {
+		return nil, nil, newVerificationError(err, header, tokeninfo)
+	}
+
+	if len(opts.AllowedKeyThumbprints) > 0 {
+		if err := checkKeyPinned(certs, header.Kid, opts.AllowedKeyThumbprints); err != nil {
+			return nil, nil, newVerificationError(err, header, tokeninfo)
+		}
+	}
+	if err := verifyTokenSignature(certs, header, messageToSign, signature); err != nil {
+		return nil, nil, newVerificationError(err, header, tokeninfo)
+	}
+	return tokeninfo, payload, nil
+}
+
+// VerifyJWT checks only the signature of authToken against certs and returns its claims undecoded.
+// Unlike VerifyGoogleIDToken, none of the claims are checked, not even exp, so callers verifying
+// tokens from other providers must check the issuer, audience and expiry themselves
+func VerifyJWT(authToken string, certs *Certs) (map[string]json.RawMessage, error) {
+	if len(authToken) > defaultMaxTokenSize {
+		return nil, ErrorTokenTooLarge
+	}
+	bt, payload, signature, messageToSign, err := divideAuthToken(authToken)
+	if err != nil {
+		return nil, err
+	}
+	header, err := getAuthTokenHeader(bt)
+	if err != nil {
+		return nil, err
+	}
+	if header.Kid == "" {
+		return nil, ErrorTokenMissingKeyID
+	}
+	if err := checkAlgorithm(header.Alg); err != nil {
+		return nil, err
+	}
+	if err := verifyTokenSignature(certs, header, messageToSign, signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorTokenMalformedPayload, err)
+	}
+	if claims == nil {
+		return nil, ErrorTokenMalformedPayload
+	}
+	return claims, nil
+}
+
+// verifyTokenSignature checks signature over messageToSign with the key header names in certs
+func verifyTokenSignature(certs *Certs, header *tokenHeader, messageToSign []byte, signature []byte) error {
+	pub, err := certs.publicKey(header.Kid)
+	if err != nil {
+		return err
+	}
+	if err := checkKeyAlgorithm(certs, header); err != nil {
+		return err
+	}
+	return verifySignature(pub, header.Alg, messageToSign, signature)
+}
 
-	tokeninfo := getTokenInfo(payload)
-	if aud != tokeninfo.Aud {
-		return nil, ErrorTokenInvalidAudience
+// checkClaims checks the decoded claims against opts
+func checkClaims(tokeninfo *TokenInfo, opts VerifyOptions) error {
+	if !hasAudience(tokeninfo) {
+		return newMissingAudienceError()
 	}
-	if (tokeninfo.Iss != "accounts.google.com") && (tokeninfo.Iss != "https://accounts.google.com") {
-		return nil, ErrorTokenInvalidISS
+	if !checkAudience(tokeninfo, opts.Audiences) {
+		return newAudienceError(tokeninfo.Aud, opts.Audiences)
 	}
-	if !checkTime(tokeninfo) {
-		return nil, ErrorTokenExpired
+	if !opts.SkipIssuerCheck && !checkIssuer(tokeninfo, opts.issuers()) {
+		return newIssuerError(tokeninfo.Iss, opts.issuers())
 	}
+	if opts.ExpectedAzp != "" && !constantTimeEqual(opts.ExpectedAzp, tokeninfo.Azp) {
+		return newAzpError(tokeninfo.Azp, opts.ExpectedAzp)
+	}
+	if opts.ExpectedHostedDomain != "" && opts.ExpectedHostedDomain != tokeninfo.Hd {
+		return newHostedDomainError(tokeninfo.Hd, opts.ExpectedHostedDomain)
+	}
+	if opts.ExpectedNonce != "" && !constantTimeEqual(opts.ExpectedNonce, tokeninfo.Nonce) {
+		return ErrorTokenInvalidNonce
+	}
+	if opts.RequireSubject && tokeninfo.Sub == "" {
+		return ErrorTokenMissingSubject
+	}
+	if opts.RequireEmailVerified && !bool(tokeninfo.EmailVerified) {
+		return ErrorTokenEmailNotVerified
+	}
+	if len(opts.AllowedEmailDomains) > 0 && !checkEmailDomain(tokeninfo, opts.AllowedEmailDomains) {
+		return newEmailDomainError(tokeninfo.Email, opts.AllowedEmailDomains)
+	}
+	return validateTimes(tokeninfo, opts)
+}
+
+// minRSAKeyBits is the shortest RSA modulus accepted. Google's keys are 2048 bits
+const minRSAKeyBits = 2048
+
+// parsePublicKey decodes the RSA or P-256 public key described by key
+func parsePublicKey(key *Key) (crypto.PublicKey, error) {
+	if !key.supported() {
+		return nil, newKeyError(key.Kid)
+	}
+	switch key.Kty {
+	case "RSA":
+		n, err := keyInt(key, "n", key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := keyInt(key, "e", key.E)
+		if err != nil {
+			return nil, err
+		}
+		// The exponent may be padded with leading zeros to any length, but must fit in an int
+		if !e.IsInt64() || e.Int64() > math.MaxInt {
+			return nil, fmt.Errorf("%w: kid %q has an exponent that doesn't fit in an int", ErrorCertsMalformed, key.Kid)
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("%w: kid %q has %d bits", ErrorWeakSigningKey, key.Kid, pub.N.BitLen())
+		}
+		return pub, nil
+	default:
+		x, err := keyInt(key, "x", key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := keyInt(key, "y", key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+}
 
-	key, err := choiceKeyByKeyID(certs.Keys, getAuthTokenKeyID(header))
+// keyInt decodes the big-endian integer in the base64url field name of key. Whitespace, such as the
+// line breaks of a document wrapped by hand, and padding, however much, are dropped first
+func keyInt(key *Key, name string, value string) (*big.Int, error) {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, value)
+	bt, err := urlsafeB64decode(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: kid %q has an invalid %s: %w", ErrorCertsMalformed, key.Kid, name, err)
+	}
+	return byteToInt(bt), nil
+}
+
+var errECDSAVerification = errors.New("crypto/ecdsa: verification error")
+
+// algorithmHashes maps each supported signing algorithm to the hash it signs a digest of
+var algorithmHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+}
+
+// verifySignature checks signature over messageToSign with pub, using the algorithm from the token header
+func verifySignature(pub crypto.PublicKey, alg string, messageToSign []byte, signature []byte) error {
+	if len(signature) == 0 {
+		return ErrorTokenMalformedSignature
+	}
+	hash, ok := algorithmHashes[alg]
+	if !ok {
+		return newAlgorithmError(alg)
+	}
+	switch pKey := pub.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return newAlgorithmError(alg)
+		}
+		// PKCS #1 v1.5 signatures are exactly as long as the modulus
+		if len(signature) != (pKey.N.BitLen()+7)/8 {
+			return ErrorTokenMalformedSignature
+		}
+		if err := rsa.VerifyPKCS1v15(pKey, hash, calcSum(string(messageToSign), hash), signature); err != nil {
+			return fmt.Errorf("%w: %w", ErrorTokenSignatureInvalid, err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return newAlgorithmError(alg)
+		}
+		// JWS encodes ES256 signatures as the 32-byte r and s values concatenated
+		if len(signature) != 64 {
+			return ErrorTokenMalformedSignature
+		}
+		if !ecdsa.Verify(pKey, calcSum(string(messageToSign), hash), byteToInt(signature[:32]), byteToInt(signature[32:])) {
+			return fmt.Errorf("%w: %w", ErrorTokenSignatureInvalid, errECDSAVerification)
+		}
+		return nil
+	}
+	return newAlgorithmError(alg)
+}
+
+// VerifyAtHash checks that accessToken is the one issued alongside idToken, by comparing it to the at_hash claim
+// in tokeninfo, the result of verifying idToken. at_hash is made with the hash of idToken's alg, read from its header
+func VerifyAtHash(tokeninfo *TokenInfo, idToken string, accessToken string) error {
+	bt, _, _, _, err := divideAuthToken(idToken)
+	if err != nil {
+		return err
+	}
+	header, err := getAuthTokenHeader(bt)
+	if err != nil {
+		return err
+	}
+	if err := checkAlgorithm(header.Alg); err != nil {
+		return err
+	}
+	sum := calcSum(accessToken, algorithmHashes[header.Alg])
+	atHash := base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	if tokeninfo.AtHash == "" || !constantTimeEqual(atHash, tokeninfo.AtHash) {
+		return ErrorTokenInvalidAtHash
+	}
+	return nil
+}
+
+// DecodeTokenInfo returns the claims carried by authToken.
+// It does NOT verify the signature or any claim, so the result must not be trusted;
+// it is meant for debugging and logging only
+func DecodeTokenInfo(authToken string) (*TokenInfo, error) {
+	_, payload, _, _, err := divideAuthToken(authToken)
 	if err != nil {
 		return nil, err
 	}
-	pKey := rsa.PublicKey{N: byteToInt(urlsafeB64decode(key.N)), E: btrToInt(byteToBtr(urlsafeB64decode(key.E)))}
-	err = rsa.VerifyPKCS1v15(&pKey, crypto.SHA256, messageToSign, signature)
+	tokeninfo, err := getTokenInfo(payload)
 	if err != nil {
 		return nil, err
 	}
 	return tokeninfo, nil
 }
 
-func getTokenInfo(bt []byte) *TokenInfo {
+func getTokenInfo(bt []byte) (*TokenInfo, error) {
 	var a *TokenInfo
-	json.Unmarshal(bt, &a)
-	return a
+	if err := json.Unmarshal(bt, &a); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorTokenMalformedPayload, err)
+	}
+	if a == nil {
+		return nil, ErrorTokenMalformedPayload
+	}
+	if err := json.Unmarshal(bt, &a.Claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorTokenMalformedPayload, err)
+	}
+	return a, nil
 }
 
-func checkTime(tokeninfo *TokenInfo) bool {
-	if (time.Now().Unix() < tokeninfo.Iat) || (time.Now().Unix() > tokeninfo.Exp) {
+// hasAudience reports whether the token names any audience. Access tokens passed by mistake typically don't
+func hasAudience(tokeninfo *TokenInfo) bool {
+	for _, aud := range tokeninfo.Aud {
+		if aud != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAudience reports whether the token names one of auds. An empty audience never matches,
+// since a token listing "" must not satisfy a caller that passed an unset Client ID
+func checkAudience(tokeninfo *TokenInfo, auds []string) bool {
+	for _, aud := range auds {
+		for _, tokenAud := range tokeninfo.Aud {
+			if aud != "" && tokenAud != "" && constantTimeEqual(aud, tokenAud) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func checkIssuer(tokeninfo *TokenInfo, issuers []string) bool {
+	for _, iss := range issuers {
+		if constantTimeEqual(iss, tokeninfo.Iss) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEmailDomain reports whether the part of the token's email after the @ is one of domains, ignoring case
+func checkEmailDomain(tokeninfo *TokenInfo, domains []string) bool {
+	at := strings.LastIndexByte(tokeninfo.Email, '@')
+	if at < 0 {
 		return false
 	}
-	return true
+	for _, domain := range domains {
+		if strings.EqualFold(tokeninfo.Email[at+1:], domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// constantTimeEqual compares attacker-controlled claims without leaking where they differ
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// validateTimes runs every check on the token's times as of opts.now(), allowing for opts.Leeway either way:
+// that nbf, if the token has one, has been reached, that iat isn't in the future, and that exp hasn't passed.
+// The first to fail picks the error, ErrorTokenNotYetValid, ErrorTokenUsedBeforeIssued or ErrorTokenExpired
+func validateTimes(tokeninfo *TokenInfo, opts VerifyOptions) error {
+	now, leeway := opts.now(), opts.Leeway
+	if tokeninfo.Nbf != 0 && now.Add(leeway).Before(tokeninfo.Nbf.Time()) {
+		return ErrorTokenNotYetValid
+	}
+	if now.Add(leeway).Before(tokeninfo.Iat.Time()) {
+		return newUsedBeforeIssuedError(tokeninfo)
+	}
+	if now.Add(-leeway).After(tokeninfo.Exp.Time()) {
+		return newExpiredError(tokeninfo)
+	}
+	return nil
+}
+
+// GetCertsFromURL fetches the raw JWKS document from Google's cert endpoint.
+// If client is nil, http.DefaultClient is used
+func GetCertsFromURL(client *http.Client) ([]byte, error) {
+	return GetCertsFromCustomURL(client, googleCertsURL)
+}
+
+// GetCertsFromCustomURL fetches the raw JWKS document from url, such as a local mock or a mirror of Google's keys
+func GetCertsFromCustomURL(client *http.Client, url string) ([]byte, error) {
+	return getCertsFromURL(context.Background(), client, url)
+}
+
+func getCertsFromURL(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := fetchCerts(ctx, client, url, nil, RetryPolicy{}, false)
+	if err != nil {
+		return nil, err
+	}
+	return res.body, nil
 }
 
-func GetCertsFromURL(client *http.Client) []byte {
-	res, _ := client.Get("https://www.googleapis.com/oauth2/v3/certs")
-	certs, _ := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-	return certs
+// maxCertsSize bounds the cert endpoint's response body. Google's documents are a few KB
+const maxCertsSize = 1 << 20
+
+// certsResponse is the outcome of a successful cert request
+type certsResponse struct {
+	// body is the raw document, unless it was decoded straight into certs
+	body   []byte
+	certs  *Certs
+	header http.Header
+	// notModified is set when the server answered a conditional request with 304 and no body
+	notModified bool
 }
 
-func GetCerts(bt []byte) *Certs {
+// fetchCerts requests the certs at url with the extra request headers reqHeader,
+// retrying transient failures according to retry. If decode is set, the JWKS document
+// is decoded as it streams in rather than buffered in body
+func fetchCerts(ctx context.Context, client *http.Client, url string, reqHeader http.Header, retry RetryPolicy, decode bool) (*certsResponse, error) {
+	var res *certsResponse
+	err := retry.do(ctx, func() error {
+		var err error
+		res, err = fetchCertsOnce(ctx, client, url, reqHeader, decode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func fetchCertsOnce(ctx context.Context, client *http.Client, url string, reqHeader http.Header, decode bool) (*certsResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errPermanent{newFetchError(err)}
+	}
+	for key, values := range reqHeader {
+		req.Header[key] = values
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, newFetchError(err)
+	}
+	// http.Client fills in both, but a misbehaving wrapper around it may not
+	if res == nil || res.Body == nil {
+		return nil, errPermanent{newFetchError(fmt.Errorf("%w: no response body", ErrorCertsFetchInvalid))}
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "" {
+		return &certsResponse{header: res.Header, notModified: true}, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%w: %s", ErrorCertsFetchFailed, res.Status)
+		// Only server errors and throttling are worth another attempt
+		if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			return nil, errPermanent{err}
+		}
+		return nil, err
+	}
+	// Proxies and captive portals answer with HTML pages that would only fail to parse
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "text/html" {
+		return nil, errPermanent{newFetchError(fmt.Errorf("%w: Content-Type %s", ErrorCertsFetchInvalid, mediaType))}
+	}
+	body := http.MaxBytesReader(nil, res.Body, maxCertsSize)
+	tooLarge := func(err error) bool {
+		var maxBytesErr *http.MaxBytesError
+		return errors.As(err, &maxBytesErr)
+	}
+	if decode {
+		var certs *Certs
+		dec := json.NewDecoder(body)
+		err := dec.Decode(&certs)
+		if err == nil {
+			// Read through to the end, so a connection dropped after the document or an
+			// oversized body is caught the same as when the body is buffered
+			var rest []byte
+			if rest, err = io.ReadAll(io.MultiReader(dec.Buffered(), body)); err == nil && len(bytes.TrimSpace(rest)) > 0 {
+				return nil, errPermanent{fmt.Errorf("%w: data after the document", ErrorCertsMalformed)}
+			}
+		}
+		if tooLarge(err) {
+			return nil, errPermanent{newFetchError(fmt.Errorf("%w: body exceeds %d bytes", ErrorCertsFetchInvalid, maxCertsSize))}
+		}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, io.EOF) {
+			return nil, errPermanent{fmt.Errorf("%w: %w", ErrorCertsMalformed, err)}
+		}
+		// Any other error is the body failing to arrive, such as the connection dropping midway
+		if err != nil {
+			return nil, newFetchError(err)
+		}
+		if certs, err = checkCerts(certs); err != nil {
+			return nil, errPermanent{err}
+		}
+		return &certsResponse{certs: certs, header: res.Header}, nil
+	}
+	certs, err := io.ReadAll(body)
+	if tooLarge(err) {
+		return nil, errPermanent{newFetchError(fmt.Errorf("%w: body exceeds %d bytes", ErrorCertsFetchInvalid, maxCertsSize))}
+	}
+	if err != nil {
+		return nil, newFetchError(err)
+	}
+	return &certsResponse{body: certs, header: res.Header}, nil
+}
+
+// GetCerts parses a JWKS document, as served by Google's cert endpoint
+func GetCerts(bt []byte) (*Certs, error) {
 	var certs *Certs
-	json.Unmarshal(bt, &certs)
-	return certs
+	if err := json.Unmarshal(bt, &certs); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorCertsMalformed, err)
+	}
+	return checkCerts(certs)
+}
+
+// GetCertsFromReader is like GetCerts, decoding the JWKS document as it is read from r
+// rather than from a buffer holding all of it. Anything after the document is not read
+func GetCertsFromReader(r io.Reader) (*Certs, error) {
+	var certs *Certs
+	if err := json.NewDecoder(r).Decode(&certs); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorCertsMalformed, err)
+	}
+	return checkCerts(certs)
+}
+
+// checkCerts rejects a decoded document that has no keys member, and parses its keys
+func checkCerts(certs *Certs) (*Certs, error) {
+	if certs == nil || certs.Keys == nil {
+		return nil, ErrorCertsMalformed
+	}
+	// Which of two keys sharing a kid a token means is ambiguous, so the key set is misconfigured or forged.
+	// Keys of unsupported types are never chosen, so they may share a kid
+	seen := make(map[string]bool, len(certs.Keys))
+	for i := range certs.Keys {
+		if !certs.Keys[i].supported() {
+			continue
+		}
+		kid := certs.Keys[i].Kid
+		if seen[kid] {
+			return nil, fmt.Errorf("%w: %q", ErrorCertsDuplicateKeyID, kid)
+		}
+		seen[kid] = true
+	}
+	certs.once.Do(certs.parseKeys)
+	return certs, nil
 }
 
-func urlsafeB64decode(str string) []byte {
+// urlsafeB64decode decodes base64url, with or without padding. Some clients wrongly encode with
+// the standard alphabet's + and /, so that is tried before giving up
+func urlsafeB64decode(str string) ([]byte, error) {
 	if m := len(str) % 4; m != 0 {
 		str += strings.Repeat("=", 4-m)
 	}
-	bt, _ := base64.URLEncoding.DecodeString(str)
-	return bt
+	bt, err := base64.URLEncoding.DecodeString(str)
+	if err == nil {
+		return bt, nil
+	}
+	if bt, stdErr := base64.StdEncoding.DecodeString(str); stdErr == nil {
+		return bt, nil
+	}
+	return nil, err
 }
 
-func choiceKeyByKeyID(a []keys, tknkid string) (*keys, error) {
-	for _, key := range a {
-		if key.Kid == tknkid {
-			return &key, nil
+// choiceKeyByKeyID returns the first key named tknkid that is of a supported type,
+// the same one parseKeys chooses, passing over any unsupported key sharing its kid
+func choiceKeyByKeyID(a []Key, tknkid string) (*Key, error) {
+	for i := range a {
+		if a[i].Kid == tknkid && a[i].supported() {
+			return &a[i], nil
 		}
 	}
 
-	return nil, ErrorTokenInvalidKey
+	return nil, newKeyError(tknkid)
 }
 
-func getAuthTokenKeyID(bt []byte) string {
-	var a keys
-	json.Unmarshal(bt, &a)
-	return a.Kid
+// KeyID returns the kid from the header of authToken, naming the key it claims to be signed with.
+// Like DecodeTokenInfo, it does NOT verify the token
+func KeyID(authToken string) (string, error) {
+	bt, _, _, _, err := divideAuthToken(authToken)
+	if err != nil {
+		return "", err
+	}
+	header, err := getAuthTokenHeader(bt)
+	if err != nil {
+		return "", err
+	}
+	if header.Kid == "" {
+		return "", ErrorTokenMissingKeyID
+	}
+	return header.Kid, nil
 }
 
-func divideAuthToken(str string) ([]byte, []byte, []byte, []byte) {
-	args := strings.Split(str, ".")
-	return urlsafeB64decode(args[0]), urlsafeB64decode(args[1]), urlsafeB64decode(args[2]), calcSum(args[0] + "." + args[1])
+func getAuthTokenHeader(bt []byte) (*tokenHeader, error) {
+	var a *tokenHeader
+	if err := json.Unmarshal(bt, &a); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorTokenMalformedHeader, err)
+	}
+	if a == nil {
+		return nil, ErrorTokenMalformedHeader
+	}
+	return a, nil
 }
 
-func byteToBtr(bt0 []byte) *bytes.Reader {
-	var bt1 []byte
-	if len(bt0) < 8 {
-		bt1 = make([]byte, 8-len(bt0), 8)
-		bt1 = append(bt1, bt0...)
-	} else {
-		bt1 = bt0
+// checkAlgorithm only accepts RS256, which is what Google signs ID tokens with, RS384, RS512 and ES256.
+// Anything else, including "none", is rejected before the signature is looked at
+func checkAlgorithm(alg string) error {
+	if _, ok := algorithmHashes[alg]; !ok {
+		return newAlgorithmError(alg)
 	}
-	return bytes.NewReader(bt1)
+	return nil
 }
 
-func calcSum(str string) []byte {
-	a := sha256.New()
-	a.Write([]byte(str))
-	return a.Sum(nil)
+// checkKeyAlgorithm rejects a token whose alg differs from the alg its key is advertised for,
+// so that a key can't be used with an algorithm it wasn't published for. Keys without an alg accept any
+func checkKeyAlgorithm(certs *Certs, header *tokenHeader) error {
+	key, err := choiceKeyByKeyID(certs.Keys, header.Kid)
+	if err != nil {
+		return err
+	}
+	if key.Alg != "" && key.Alg != header.Alg {
+		return fmt.Errorf("%w: token alg %q, key alg %q", ErrorTokenAlgorithmMismatch, header.Alg, key.Alg)
+	}
+	return nil
 }
 
-func btrToInt(a io.Reader) int {
-	var e uint64
-	binary.Read(a, binary.BigEndian, &e)
-	return int(e)
+func divideAuthToken(str string) ([]byte, []byte, []byte, []byte, error) {
+	args := strings.Split(str, ".")
+	if len(args) != 3 {
+		return nil, nil, nil, nil, ErrorTokenMalformed
+	}
+	segments := make([][]byte, len(args))
+	for i, arg := range args {
+		bt, err := urlsafeB64decode(arg)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("%w: %s: %w", ErrorTokenMalformed, segmentNames[i], err)
+		}
+		segments[i] = bt
+	}
+	return segments[0], segments[1], segments[2], []byte(args[0] + "." + args[1]), nil
+}
+
+// segmentNames names the parts of a token, in order, for error messages
+var segmentNames = []string{"header", "payload", "signature"}
+
+// calcSum returns the digest of data with h, the hash named by the token's alg
+func calcSum(data string, h crypto.Hash) []byte {
+	a := h.New()
+	a.Write([]byte(data))
+	return a.Sum(nil)
 }
 
 func byteToInt(bt []byte) *big.Int {
-	a := big.NewInt(0)
-	a.SetBytes(bt)
-	return a
+	return new(big.Int).SetBytes(bt)
 }
@@ -1,14 +1,2227 @@
 package GoogleIdTokenVerifier
 
-import "testing"
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyID = "1e9gdk7"
+	testAud   = "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX.apps.googleusercontent.com"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+// testSigningKey returns an RSA key shared by all tests in the package
+func testSigningKey(t testing.TB) *rsa.PrivateKey {
+	testKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		testKey = key
+	})
+	return testKey
+}
+
+// testCerts returns a JWKS containing the public half of testSigningKey
+func testCerts(t testing.TB) *Certs {
+	pub := testSigningKey(t).PublicKey
+	return &Certs{Keys: []Key{{
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		Kid: testKeyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
+
+// testClaims returns claims that pass every check for testAud
+func testClaims() map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":   "https://accounts.google.com",
+		"aud":   testAud,
+		"azp":   testAud,
+		"sub":   "110169484474386276334",
+		"email": "testuser@gmail.com",
+		"iat":   now,
+		"exp":   now + 3600,
+	}
+}
+
+// signTestToken encodes header and claims and signs them with testSigningKey
+func signTestToken(t testing.TB, header, claims map[string]interface{}) string {
+	if header == nil {
+		header = map[string]interface{}{"alg": "RS256", "kid": testKeyID, "typ": "JWT"}
+	}
+	return encodeTestToken(t, header, claims, func(digest []byte) []byte {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, testSigningKey(t), testHash(header), digest)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return sig
+	})
+}
+
+// encodeTestToken encodes header and claims and appends the signature sign produces for their digest
+func encodeTestToken(t testing.TB, header, claims map[string]interface{}, sign func(digest []byte) []byte) string {
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(calcSum(signingInput, testHash(header))))
+}
+
+// testHash returns the hash for the header's alg, or SHA-256 for algorithms we don't support
+func testHash(header map[string]interface{}) crypto.Hash {
+	alg, _ := header["alg"].(string)
+	if hash, ok := algorithmHashes[alg]; ok {
+		return hash
+	}
+	return crypto.SHA256
+}
 
 func TestCheckToken(t *testing.T) {
 	authToken := "XXXXXXXXXXX.XXXXXXXXXXXX.XXXXXXXXXX"
 	aud := "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX.apps.googleusercontent.com"
-	actual := Verify(authToken, aud)
+	actual, _ := VerifyGoogleIDToken(authToken, &Certs{}, aud)
 	var token *TokenInfo
 	expected := token
 	if actual != expected {
 		t.Errorf("got %v\nwant %v", actual, expected)
 	}
 }
+
+func TestVerifyMalformedToken(t *testing.T) {
+	aud := "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX.apps.googleusercontent.com"
+	tests := []struct {
+		name      string
+		authToken string
+	}{
+		{"empty", ""},
+		{"one segment", "XXXXXXXXXXX"},
+		{"two segments", "XXXXXXXXXXX.XXXXXXXXXXXX"},
+		{"four segments", "XXXXXXXXXXX.XXXXXXXXXXXX.XXXXXXXXXX.XXXXXXXXXX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := VerifyGoogleIDToken(tt.authToken, &Certs{}, aud)
+			if !errors.Is(err, ErrorTokenMalformed) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenMalformed)
+			}
+			if actual != nil {
+				t.Errorf("got %v\nwant nil", actual)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalidBase64(t *testing.T) {
+	parts := strings.Split(signTestToken(t, nil, testClaims()), ".")
+	header, payload, signature := parts[0], parts[1], parts[2]
+	tests := []struct {
+		name      string
+		authToken string
+	}{
+		{"header outside alphabet", "*" + header[1:] + "." + payload + "." + signature},
+		{"payload outside alphabet", header + "." + payload[:8] + "!" + payload[9:] + "." + signature},
+		{"mixed alphabets", header + "." + payload[:8] + "+_" + payload[10:] + "." + signature},
+		{"padding mid-segment", header + "." + payload[:8] + "==" + payload[8:] + "." + signature},
+		{"excess padding", header + "." + payload + "." + signature + "==="},
+		{"impossible length", header + "." + payload + "." + signature[:len(signature)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := VerifyGoogleIDToken(tt.authToken, testCerts(t), testAud)
+			if !errors.Is(err, ErrorTokenMalformed) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenMalformed)
+			}
+			if actual != nil {
+				t.Errorf("got %v\nwant nil", actual)
+			}
+		})
+	}
+
+	key := testCerts(t).Keys[0]
+	key.N = "*" + key.N[1:]
+	if _, err := parsePublicKey(&key); !errors.Is(err, ErrorCertsMalformed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsMalformed)
+	}
+}
+
+func TestVerifyKeyWhitespace(t *testing.T) {
+	key := testCerts(t).Keys[0]
+	var wrapped strings.Builder
+	for i := 0; i < len(key.N); i += 64 {
+		wrapped.WriteString(key.N[i:min(i+64, len(key.N))])
+		wrapped.WriteString("\r\n")
+	}
+	tests := []struct {
+		name string
+		n    string
+		e    string
+	}{
+		{"trailing newline", key.N + "\n", key.E},
+		{"surrounding spaces", "  " + key.N + "\t", " " + key.E + " "},
+		{"line wrapped", wrapped.String(), key.E},
+		{"padded", key.N + "==", key.E + "===="},
+		{"padded then newline", key.N + "==\n", key.E},
+	}
+	authToken := signTestToken(t, nil, testClaims())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contaminated := key
+			contaminated.N, contaminated.E = tt.n, tt.e
+			document, err := json.Marshal(Certs{Keys: []Key{contaminated}})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if _, err := VerifyGoogleIDToken(authToken, mustGetCerts(t, string(document)), testAud); err != nil {
+				t.Errorf("got %v\nwant nil", err)
+			}
+		})
+	}
+
+	contaminated := key
+	contaminated.N = key.N[:100] + "!" + key.N[100:]
+	if _, err := parsePublicKey(&contaminated); !errors.Is(err, ErrorCertsMalformed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsMalformed)
+	}
+}
+
+func TestVerifyStandardBase64(t *testing.T) {
+	claims := testClaims()
+	// Runs of five of these are bound to encode to + and / respectively, whatever their offset
+	claims["note"] = "~~~~~?????"
+	header := map[string]interface{}{"alg": "RS256", "kid": testKeyID, "typ": "JWT"}
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.StdEncoding} {
+		signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(c)
+		if !strings.Contains(signingInput, "+") || !strings.Contains(signingInput, "/") {
+			t.Fatalf("got %q\nwant a + and a / to exercise the fallback", signingInput)
+		}
+		sig, err := rsa.SignPKCS1v15(rand.Reader, testSigningKey(t), crypto.SHA256, calcSum(signingInput, crypto.SHA256))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		actual, err := VerifyGoogleIDToken(signingInput+"."+encoding.EncodeToString(sig), testCerts(t), testAud)
+		if err != nil {
+			t.Fatalf("got %v\nwant nil", err)
+		}
+		if actual.Claims["note"] != "~~~~~?????" {
+			t.Errorf("got %v\nwant %v", actual.Claims["note"], "~~~~~?????")
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenWithPayload(t *testing.T) {
+	authToken := signTestToken(t, nil, testClaims())
+	expected, err := base64.RawURLEncoding.DecodeString(strings.Split(authToken, ".")[1])
+	if err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	tokeninfo, payload, err := VerifyGoogleIDTokenWithPayload(authToken, testCerts(t), testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if string(payload) != string(expected) {
+		t.Errorf("got %s\nwant %s", payload, expected)
+	}
+	if tokeninfo.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", tokeninfo.Sub, "110169484474386276334")
+	}
+
+	tokeninfo, payload, err = VerifyGoogleIDTokenWithPayload(authToken, testCerts(t), "other")
+	if !errors.Is(err, ErrorTokenInvalidAudience) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+	}
+	if tokeninfo != nil || payload != nil {
+		t.Errorf("got %v, %s\nwant nil", tokeninfo, payload)
+	}
+}
+
+func TestVerifyDetailed(t *testing.T) {
+	const rotatedKeyID = "rotated"
+	certs := testCerts(t)
+	rotated := certs.Keys[0]
+	rotated.Kid = rotatedKeyID
+	certs.Keys = append(certs.Keys, rotated)
+	for _, kid := range []string{testKeyID, rotatedKeyID} {
+		authToken := signTestToken(t, map[string]interface{}{"alg": "RS256", "kid": kid, "typ": "JWT"}, testClaims())
+		tokeninfo, actual, err := VerifyDetailed(authToken, certs, testAud)
+		if err != nil {
+			t.Fatalf("%s: got %v\nwant nil", kid, err)
+		}
+		if actual != kid {
+			t.Errorf("got %q\nwant %q", actual, kid)
+		}
+		if tokeninfo.Sub != "110169484474386276334" {
+			t.Errorf("got %q\nwant %q", tokeninfo.Sub, "110169484474386276334")
+		}
+	}
+
+	tokeninfo, kid, err := VerifyDetailed(signTestToken(t, nil, testClaims()), certs, "other")
+	if !errors.Is(err, ErrorTokenInvalidAudience) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+	}
+	if tokeninfo != nil || kid != "" {
+		t.Errorf("got %v, %q\nwant nil and no kid", tokeninfo, kid)
+	}
+}
+
+func TestVerifyInto(t *testing.T) {
+	type firebaseClaims struct {
+		Identities     map[string][]string `json:"identities"`
+		SignInProvider string              `json:"sign_in_provider"`
+	}
+	type customClaims struct {
+		Sub      string         `json:"sub"`
+		Email    string         `json:"email"`
+		Exp      NumericDate    `json:"exp"`
+		Roles    []string       `json:"roles"`
+		TenantID int            `json:"tenant_id"`
+		Firebase firebaseClaims `json:"firebase"`
+	}
+	claims := testClaims()
+	claims["roles"] = []string{"admin", "billing"}
+	claims["tenant_id"] = 42
+	claims["firebase"] = map[string]interface{}{"identities": map[string][]string{"email": {"testuser@gmail.com"}}, "sign_in_provider": "password"}
+	authToken := signTestToken(t, nil, claims)
+
+	provider := &StaticKeyProvider{Certs: testCerts(t)}
+	var actual customClaims
+	if err := verifyInto(context.Background(), authToken, testAud, &actual, provider); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := customClaims{
+		Sub:      "110169484474386276334",
+		Email:    "testuser@gmail.com",
+		Exp:      NumericDate(claims["exp"].(int64)),
+		Roles:    []string{"admin", "billing"},
+		TenantID: 42,
+		Firebase: firebaseClaims{Identities: map[string][]string{"email": {"testuser@gmail.com"}}, SignInProvider: "password"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %+v\nwant %+v", actual, expected)
+	}
+
+	var rejected customClaims
+	if err := verifyInto(context.Background(), authToken, "other", &rejected, provider); !errors.Is(err, ErrorTokenInvalidAudience) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+	}
+	if !reflect.DeepEqual(rejected, customClaims{}) {
+		t.Errorf("got %+v\nwant dest untouched", rejected)
+	}
+
+	var mistyped struct {
+		Roles string `json:"roles"`
+	}
+	// dest not matching the claims is the caller's mistake, not the client's
+	var typeErr *json.UnmarshalTypeError
+	if err := verifyInto(context.Background(), authToken, testAud, &mistyped, provider); !errors.As(err, &typeErr) || IsTokenError(err) {
+		t.Errorf("got %v\nwant a %T that isn't a token error", err, typeErr)
+	}
+	var invalidErr *json.InvalidUnmarshalError
+	if err := verifyInto(context.Background(), authToken, testAud, actual, provider); !errors.As(err, &invalidErr) || IsTokenError(err) {
+		t.Errorf("got %v\nwant a %T that isn't a token error", err, invalidErr)
+	}
+}
+
+// googleCertsJSON is a JWKS document in the shape served by
+// https://www.googleapis.com/oauth2/v3/certs.
+const googleCertsJSON = `{
+  "keys": [
+    {
+      "e": "AQAB",
+      "kty": "RSA",
+      "alg": "RS256",
+      "n": "yx9MOGfYSWgScDdlTolxgdxxekKsm9UzRSkK7bsapaJA2gD0pDbBLD3uKA3SaeA-hXbRPeYpLKR6lChRatFXyFNogVOcc8hz3vH8J237isbnLYNLWv96qfpMfb9q6eW4DHWJm3azRy0my5gf_VAEtt1UQs1U5cvCKyosZ6-Qq2NbSnbQ38gsX0uGHl_Hh3mIRxNv6woTd5cMxDeVuZ-SbuBWJbs0swvmanTr9x9U8d4aoJ7U6GcLSnmvlqcqcuSM_1LCEgIqdYPooYPwkHMq1SAB-DbPk-i3jg1Vfec8FscFghBphKU01ShHdCuwi6PzgmkwvtDY901zMeb2pQ0WaQ",
+      "use": "sig",
+      "kid": "6f7254101f56e41cf35c9926de84a2d552b4c6f1"
+    },
+    {
+      "e": "AQAB",
+      "kty": "RSA",
+      "alg": "RS256",
+      "n": "pIbYBDOM7xRccduoRzwLRm4BSQqpx24ETXegLtQN8xyTpqr_l2PffP2RWj6gB96GuLIk_TOj_TclNu00hF6ZCiRmn4DUcN8S-Ouon2UZk08Ig0xCaey8X2QiZD1U0K73Za2YXalC9rr-X6ZWRl4zYfv7Ij9xALSHheok8soluQIxF-xC6HErIv3kuJuFdBM1oM_klSwtSxHrQSq8deNarSs_doFKIPg5bKdjGjdESQMYv_UhNR5iCG4Zm3qhNOTZkTFGoUQguxDhFVeqwyD7kSqaRY5XdnwaoQtdtORDMy63GgYbJArdH6enIl9qHq1sk7MRbo8Xk09tBqcF9a2RBw",
+      "use": "sig",
+      "kid": "a06af0b68a2119d692cac4abf415ff3788136f65"
+    }
+  ]
+}`
+
+func mustGetCerts(t testing.TB, document string) *Certs {
+	certs, err := GetCerts([]byte(document))
+	if err != nil {
+		t.Fatalf("GetCerts: %v", err)
+	}
+	return certs
+}
+
+func TestGetCertsKeyID(t *testing.T) {
+	certs := mustGetCerts(t, googleCertsJSON)
+	if len(certs.Keys) != 2 {
+		t.Fatalf("got %v\nwant 2 keys", certs)
+	}
+	expected := []string{"6f7254101f56e41cf35c9926de84a2d552b4c6f1", "a06af0b68a2119d692cac4abf415ff3788136f65"}
+	for i, kid := range expected {
+		if certs.Keys[i].Kid != kid {
+			t.Errorf("got %q\nwant %q", certs.Keys[i].Kid, kid)
+		}
+	}
+
+	key, err := choiceKeyByKeyID(certs.Keys, expected[1])
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if key.N != certs.Keys[1].N {
+		t.Errorf("got key %q\nwant key %q", key.Kid, expected[1])
+	}
+}
+
+func TestCertsKeyIDs(t *testing.T) {
+	actual := mustGetCerts(t, googleCertsJSON).KeyIDs()
+	expected := []string{"6f7254101f56e41cf35c9926de84a2d552b4c6f1", "a06af0b68a2119d692cac4abf415ff3788136f65"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v\nwant %v", actual, expected)
+	}
+	if actual := (&Certs{}).KeyIDs(); len(actual) != 0 {
+		t.Errorf("got %v\nwant no kids", actual)
+	}
+}
+
+func TestGetCertsDuplicateKeyID(t *testing.T) {
+	key := testCerts(t).Keys[0]
+	other := mustGetCerts(t, googleCertsJSON).Keys[0]
+	tests := []struct {
+		name     string
+		keys     []Key
+		expected error
+	}{
+		{"distinct kids", []Key{key, other}, nil},
+		{"identical keys", []Key{key, key}, ErrorCertsDuplicateKeyID},
+		{"different moduli", []Key{key, {Kty: "RSA", Alg: "RS256", Use: "sig", Kid: key.Kid, N: other.N, E: other.E}}, ErrorCertsDuplicateKeyID},
+		{"unsupported duplicate", []Key{{Kty: "OKP", Crv: "Ed25519", Kid: key.Kid, X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}, key}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := json.Marshal(Certs{Keys: tt.keys})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			for _, parse := range []func([]byte) (*Certs, error){
+				GetCerts,
+				func(bt []byte) (*Certs, error) { return GetCertsFromReader(strings.NewReader(string(bt))) },
+			} {
+				certs, err := parse(document)
+				if !errors.Is(err, tt.expected) {
+					t.Errorf("got %v\nwant %v", err, tt.expected)
+				}
+				if tt.expected != nil && certs != nil {
+					t.Errorf("got %v\nwant nil", certs)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenMixedKeyTypes(t *testing.T) {
+	rsaKey := testCerts(t).Keys[0]
+	document := fmt.Sprintf(`{
+		"keys": [
+			{"kty": "OKP", "alg": "EdDSA", "crv": "Ed25519", "kid": %[1]q, "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			{"kty": "oct", "alg": "HS256", "kid": %[1]q, "k": "GawgguFyGrWKav7AX4VKUg"},
+			{"kty": "EC", "crv": "P-384", "kid": "ec384", "x": "AQ", "y": "AQ"},
+			{"kty": "RSA", "alg": "RS256", "use": "sig", "kid": %[1]q, "n": %[2]q, "e": %[3]q}
+		],
+		"next_rotation": "2026-11-01T00:00:00Z"
+	}`, rsaKey.Kid, rsaKey.N, rsaKey.E)
+	certs := mustGetCerts(t, document)
+	if len(certs.Keys) != 4 {
+		t.Fatalf("got %d keys\nwant 4", len(certs.Keys))
+	}
+
+	actual, err := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), certs, testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+
+	_, err = VerifyGoogleIDToken(signTestToken(t, map[string]interface{}{"alg": "RS256", "kid": "ec384"}, testClaims()), certs, testAud)
+	if !errors.Is(err, ErrorTokenInvalidKey) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+	}
+}
+
+func TestCertsByHand(t *testing.T) {
+	pub := testSigningKey(t).PublicKey
+	certs := &Certs{Keys: []Key{{
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		Kid: testKeyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+	actual, err := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), certs, testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+}
+
+func TestCertsJSONRoundTrip(t *testing.T) {
+	expected := mustGetCerts(t, googleCertsJSON)
+	bt, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	actual := mustGetCerts(t, string(bt))
+	if !reflect.DeepEqual(actual.Keys, expected.Keys) {
+		t.Errorf("got %+v\nwant %+v", actual.Keys, expected.Keys)
+	}
+
+	bt, err = json.Marshal(Key{Kty: "EC", Kid: "ec", Crv: "P-256", X: "x", Y: "y"})
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if expected := `{"kty":"EC","alg":"","use":"","kid":"ec","crv":"P-256","x":"x","y":"y"}`; string(bt) != expected {
+		t.Errorf("got %s\nwant %s", bt, expected)
+	}
+}
+
+func TestGetCertsFromCustomURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write([]byte(googleCertsJSON))
+	}))
+	defer ts.Close()
+
+	actual, err := GetCertsFromCustomURL(ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if string(actual) != googleCertsJSON {
+		t.Errorf("got %q\nwant %q", actual, googleCertsJSON)
+	}
+	certs := mustGetCerts(t, string(actual))
+	if _, err := choiceKeyByKeyID(certs.Keys, "a06af0b68a2119d692cac4abf415ff3788136f65"); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+}
+
+func TestGetCertsFromURLServerError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "backend unavailable", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	actual, err := GetCertsFromCustomURL(ts.Client(), ts.URL)
+	if !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+	if actual != nil {
+		t.Errorf("got %q\nwant nil", actual)
+	}
+}
+
+func TestGetCertsFromURLTransportError(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport roundTripFunc
+		expected  error
+	}{
+		{"dial error", func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("dial tcp: no route to host")
+		}, ErrorCertsFetchFailed},
+		{"nil response", func(r *http.Request) (*http.Response, error) {
+			return nil, nil
+		}, ErrorCertsFetchFailed},
+		{"nil body", func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil
+		}, ErrorCertsMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: tt.transport}
+			_, err := fetchCerts(context.Background(), client, googleCertsURL, nil, RetryPolicy{Backoff: time.Millisecond}, true)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+
+	actual, err := GetCertsFromURL(&http.Client{Transport: tests[0].transport})
+	if !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+	if actual != nil {
+		t.Errorf("got %q\nwant nil", actual)
+	}
+}
+
+func TestGetCertsFromURLInvalidResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    error
+	}{
+		{"json", "application/json; charset=UTF-8", googleCertsJSON, nil},
+		{"no content type", "", googleCertsJSON, nil},
+		{"at limit", "application/json", googleCertsJSON + strings.Repeat(" ", maxCertsSize-len(googleCertsJSON)), nil},
+		{"oversized", "application/json", googleCertsJSON + strings.Repeat(" ", maxCertsSize-len(googleCertsJSON)+1), ErrorCertsFetchInvalid},
+		{"html error page", "text/html; charset=utf-8", "<html><body>Proxy error</body></html>", ErrorCertsFetchInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&fetches, 1)
+				w.Header()["Content-Type"] = []string{tt.contentType}
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			for _, decode := range []bool{false, true} {
+				atomic.StoreInt32(&fetches, 0)
+				_, err := fetchCerts(context.Background(), ts.Client(), ts.URL, nil, RetryPolicy{Backoff: time.Millisecond}, decode)
+				if !errors.Is(err, tt.expected) {
+					t.Errorf("decode %v: got %v\nwant %v", decode, err, tt.expected)
+				}
+				if tt.expected != nil && !errors.Is(err, ErrorCertsFetchFailed) {
+					t.Errorf("decode %v: got %v\nwant %v", decode, err, ErrorCertsFetchFailed)
+				}
+				if fetches != 1 {
+					t.Errorf("decode %v: got %d fetches\nwant 1", decode, fetches)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCertsFromURLTruncatedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(googleCertsJSON[:32]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	actual, err := GetCertsFromCustomURL(ts.Client(), ts.URL)
+	if err == nil {
+		t.Errorf("got nil\nwant error")
+	}
+	if actual != nil {
+		t.Errorf("got %q\nwant nil", actual)
+	}
+}
+
+func TestGetCertsFromURLTruncatedBodyRetried(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			w.Write([]byte(googleCertsJSON))
+			return
+		}
+		w.Header().Set("Content-Length", "4096")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(googleCertsJSON[:32]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	for _, decode := range []bool{false, true} {
+		atomic.StoreInt32(&fetches, 0)
+		_, err := fetchCerts(context.Background(), ts.Client(), ts.URL, nil, RetryPolicy{Backoff: time.Millisecond}, decode)
+		if err != nil {
+			t.Errorf("decode %v: got %v\nwant nil", decode, err)
+		}
+		if fetches != 2 {
+			t.Errorf("decode %v: got %d fetches\nwant 2", decode, fetches)
+		}
+	}
+}
+
+func TestVerifyContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	actual, err := VerifyContext(ctx, "XXXXXXXXXXX.XXXXXXXXXXXX.XXXXXXXXXX", "aud", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v\nwant %v", err, context.Canceled)
+	}
+	if actual != nil {
+		t.Errorf("got %v\nwant nil", actual)
+	}
+}
+
+func TestMustVerify(t *testing.T) {
+	client := testCertsClient(t, testCerts(t))
+	actual := MustVerify(signTestToken(t, nil, testClaims()), testAud, client)
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrorTokenMalformed) {
+			t.Errorf("got %v\nwant a panic with %v", err, ErrorTokenMalformed)
+		}
+	}()
+	MustVerify("XXX", testAud, client)
+	t.Errorf("got no panic\nwant a panic for a malformed token")
+}
+
+func TestVerifyReader(t *testing.T) {
+	client := testCertsClient(t, testCerts(t))
+	token := signTestToken(t, nil, testClaims())
+	tests := []struct {
+		name     string
+		r        io.Reader
+		expected error
+	}{
+		{"token", strings.NewReader(token), nil},
+		{"trailing newline", strings.NewReader(token + "\r\n"), nil},
+		{"at limit", strings.NewReader(token + strings.Repeat(" ", defaultMaxTokenSize-len(token))), nil},
+		{"oversized", strings.NewReader(token + strings.Repeat(" ", defaultMaxTokenSize-len(token)+1)), ErrorTokenTooLarge},
+		{"endless", endlessReader{}, ErrorTokenTooLarge},
+		{"empty", strings.NewReader(""), ErrorTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := VerifyReader(context.Background(), tt.r, testAud, client)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Sub != "110169484474386276334" {
+				t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+			}
+		})
+	}
+}
+
+// endlessReader streams an unbounded token
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'X'
+	}
+	return len(p), nil
+}
+
+func TestGetCertsFromURLDeadline(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := getCertsFromURL(ctx, ts.Client(), ts.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v\nwant %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v\nwant prompt return", elapsed)
+	}
+}
+
+func TestVerifyGoogleIDToken(t *testing.T) {
+	actual, err := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), testCerts(t), testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" || len(actual.Aud) != 1 || actual.Aud[0] != testAud {
+		t.Errorf("got %+v\nwant claims from token", actual)
+	}
+}
+
+func TestVerifyGoogleIDTokenLeeway(t *testing.T) {
+	leeway := time.Minute
+	tests := []struct {
+		name     string
+		iat      time.Duration
+		exp      time.Duration
+		leeway   time.Duration
+		expected error
+	}{
+		{"issued within leeway", leeway - 5*time.Second, time.Hour, leeway, nil},
+		{"issued beyond leeway", leeway + 5*time.Second, time.Hour, leeway, ErrorTokenUsedBeforeIssued},
+		{"expired within leeway", -time.Hour, -leeway + 5*time.Second, leeway, nil},
+		{"expired beyond leeway", -time.Hour, -leeway - 5*time.Second, leeway, ErrorTokenExpired},
+		{"issued in future without leeway", 5 * time.Second, time.Hour, 0, ErrorTokenUsedBeforeIssued},
+		{"issued in future and expired", time.Hour, -time.Hour, 0, ErrorTokenUsedBeforeIssued},
+		{"expired without leeway", -time.Hour, -5 * time.Second, 0, ErrorTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			claims := testClaims()
+			claims["iat"] = now.Add(tt.iat).Unix()
+			claims["exp"] = now.Add(tt.exp).Unix()
+			_, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, claims), testCerts(t), testAud, VerifyOptions{Leeway: tt.leeway})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyWithAudiences(t *testing.T) {
+	authToken := signTestToken(t, nil, testClaims())
+	tests := []struct {
+		name     string
+		auds     []string
+		expected error
+	}{
+		{"matching", []string{"android.apps.googleusercontent.com", testAud}, nil},
+		{"non-matching", []string{"android.apps.googleusercontent.com", "ios.apps.googleusercontent.com"}, ErrorTokenInvalidAudience},
+		{"empty", []string{}, ErrorTokenInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyWithAudiences(authToken, testCerts(t), tt.auds)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenAzp(t *testing.T) {
+	authToken := signTestToken(t, nil, testClaims())
+	tests := []struct {
+		name     string
+		azp      string
+		expected error
+	}{
+		{"match", testAud, nil},
+		{"mismatch", "other.apps.googleusercontent.com", ErrorTokenInvalidAZP},
+		{"empty expected", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyGoogleIDTokenWithOptions(authToken, testCerts(t), testAud, VerifyOptions{ExpectedAzp: tt.azp})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenHostedDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		hd       string
+		expected error
+	}{
+		{"workspace", "example.com", nil},
+		{"personal", "", ErrorTokenInvalidHostedDomain},
+		{"mismatch", "example.org", ErrorTokenInvalidHostedDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			if tt.hd != "" {
+				claims["hd"] = tt.hd
+			}
+			actual, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, claims), testCerts(t), testAud, VerifyOptions{ExpectedHostedDomain: "example.com"})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Hd != tt.hd {
+				t.Errorf("got %q\nwant %q", actual.Hd, tt.hd)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenAlgorithm(t *testing.T) {
+	tests := []struct {
+		alg      string
+		expected error
+	}{
+		{"RS256", nil},
+		{"RS384", nil},
+		{"RS512", nil},
+		{"RS1024", ErrorTokenUnsupportedAlgorithm},
+		{"PS256", ErrorTokenUnsupportedAlgorithm},
+		{"none", ErrorTokenUnsupportedAlgorithm},
+		{"HS256", ErrorTokenUnsupportedAlgorithm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			header := map[string]interface{}{"alg": tt.alg, "kid": testKeyID, "typ": "JWT"}
+			authToken := signTestToken(t, header, testClaims())
+			certs := testCerts(t)
+			certs.Keys[0].Alg = tt.alg
+			_, err := VerifyGoogleIDToken(authToken, certs, testAud)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenAlgorithmMismatch(t *testing.T) {
+	tests := []struct {
+		headerAlg string
+		keyAlg    string
+		expected  error
+	}{
+		{"RS256", "RS256", nil},
+		{"RS512", "RS256", ErrorTokenAlgorithmMismatch},
+		{"RS256", "RS384", ErrorTokenAlgorithmMismatch},
+		{"RS256", "ES256", ErrorTokenAlgorithmMismatch},
+		{"RS384", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.headerAlg+"/"+tt.keyAlg, func(t *testing.T) {
+			certs := testCerts(t)
+			certs.Keys[0].Alg = tt.keyAlg
+			header := map[string]interface{}{"alg": tt.headerAlg, "kid": testKeyID}
+			_, err := VerifyGoogleIDToken(signTestToken(t, header, testClaims()), certs, testAud)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenAlgorithmHash(t *testing.T) {
+	// An RS384 signature must not verify once the header is relabelled RS256
+	claims := testClaims()
+	header := map[string]interface{}{"alg": "RS384", "kid": testKeyID}
+	rs384 := strings.Split(signTestToken(t, header, claims), ".")
+	header["alg"] = "RS256"
+	relabelled := strings.Split(signTestToken(t, header, claims), ".")
+	if _, err := VerifyGoogleIDToken(relabelled[0]+"."+relabelled[1]+"."+rs384[2], testCerts(t), testAud); !errors.Is(err, ErrorTokenSignatureInvalid) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenSignatureInvalid)
+	}
+}
+
+func TestVerifyGoogleIDTokenAlgorithmNoneUnsigned(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"` + testKeyID + `"}`))
+	claims, _ := json.Marshal(testClaims())
+	authToken := header + "." + base64.RawURLEncoding.EncodeToString(claims) + "."
+	actual, err := VerifyGoogleIDToken(authToken, testCerts(t), testAud)
+	if !errors.Is(err, ErrorTokenUnsupportedAlgorithm) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenUnsupportedAlgorithm)
+	}
+	if actual != nil {
+		t.Errorf("got %v\nwant nil", actual)
+	}
+}
+
+// testECKeyD is the private scalar of the P-256 key used for ES256 tests
+const testECKeyD = "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721"
+
+func testECKey(t testing.TB) *ecdsa.PrivateKey {
+	d, ok := new(big.Int).SetString(testECKeyD, 16)
+	if !ok {
+		t.Fatalf("parse P-256 key")
+	}
+	priv := &ecdsa.PrivateKey{D: d}
+	priv.PublicKey.Curve = elliptic.P256()
+	priv.PublicKey.X, priv.PublicKey.Y = priv.PublicKey.Curve.ScalarBaseMult(d.Bytes())
+	return priv
+}
+
+func TestVerifyGoogleIDTokenES256(t *testing.T) {
+	priv := testECKey(t)
+	certs := &Certs{Keys: []Key{{
+		Kty: "EC",
+		Alg: "ES256",
+		Use: "sig",
+		Kid: "ec-key",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.Y.FillBytes(make([]byte, 32))),
+	}}}
+	header := map[string]interface{}{"alg": "ES256", "kid": "ec-key", "typ": "JWT"}
+	sign := func(digest []byte) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+
+	authToken := encodeTestToken(t, header, testClaims(), sign)
+	actual, err := VerifyGoogleIDToken(authToken, certs, testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+
+	forged := encodeTestToken(t, header, testClaims(), func(digest []byte) []byte { return make([]byte, 64) })
+	if _, err := VerifyGoogleIDToken(forged, certs, testAud); !errors.Is(err, ErrorTokenSignatureInvalid) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenSignatureInvalid)
+	}
+
+	rsaHeader := map[string]interface{}{"alg": "RS256", "kid": "ec-key", "typ": "JWT"}
+	if _, err := VerifyGoogleIDToken(signTestToken(t, rsaHeader, testClaims()), certs, testAud); !errors.Is(err, ErrorTokenAlgorithmMismatch) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenAlgorithmMismatch)
+	}
+	certs.Keys[0].Alg = ""
+	if _, err := VerifyGoogleIDToken(signTestToken(t, rsaHeader, testClaims()), certs, testAud); !errors.Is(err, ErrorTokenUnsupportedAlgorithm) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenUnsupportedAlgorithm)
+	}
+}
+
+func TestVerifyJWT(t *testing.T) {
+	priv := testECKey(t)
+	key, err := publicKeyToKey(&priv.PublicKey, "custom-key")
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	certs := &Certs{Keys: []Key{*key}}
+	header := map[string]interface{}{"alg": "ES256", "kid": "custom-key", "typ": "JWT"}
+	claims := map[string]interface{}{
+		"iss":   "https://auth.example.com",
+		"aud":   []string{"api", "worker"},
+		"scope": "read write",
+		"exp":   time.Now().Add(-time.Hour).Unix(),
+	}
+	sign := func(digest []byte) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+
+	actual, err := VerifyJWT(encodeTestToken(t, header, claims, sign), certs)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := map[string]string{
+		"iss":   `"https://auth.example.com"`,
+		"aud":   `["api","worker"]`,
+		"scope": `"read write"`,
+		"exp":   fmt.Sprint(claims["exp"]),
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("got %d claims\nwant %d", len(actual), len(expected))
+	}
+	for name, value := range expected {
+		if string(actual[name]) != value {
+			t.Errorf("%s: got %s\nwant %s", name, actual[name], value)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"forged", encodeTestToken(t, header, claims, func(digest []byte) []byte { return make([]byte, 64) }), ErrorTokenSignatureInvalid},
+		{"unknown kid", encodeTestToken(t, map[string]interface{}{"alg": "ES256", "kid": "other"}, claims, sign), ErrorTokenInvalidKey},
+		{"not an object", encodeTestToken(t, header, nil, sign), ErrorTokenMalformedPayload},
+		{"malformed", "XXX", ErrorTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyJWT(tt.token, certs); !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeTokenInfo(t *testing.T) {
+	claims := testClaims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	actual, err := DecodeTokenInfo(signTestToken(t, nil, claims))
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Email != "testuser@gmail.com" || len(actual.Aud) != 1 || actual.Aud[0] != testAud {
+		t.Errorf("got %+v\nwant claims from token", actual)
+	}
+}
+
+func TestDecodeTokenInfoMalformed(t *testing.T) {
+	tests := []struct {
+		authToken string
+		expected  error
+	}{
+		{"", ErrorTokenMalformed},
+		{"garbage", ErrorTokenMalformed},
+		{"a.b.c.d", ErrorTokenMalformed},
+		{"XXXXXXXXXXX.XXXXXXXXXXXX.XXXXXXXXXX", ErrorTokenMalformedPayload},
+	}
+	for _, tt := range tests {
+		actual, err := DecodeTokenInfo(tt.authToken)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: got %v\nwant %v", tt.authToken, err, tt.expected)
+		}
+		if actual != nil {
+			t.Errorf("%q: got %v\nwant nil", tt.authToken, actual)
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenCustomClaims(t *testing.T) {
+	claims := testClaims()
+	claims["nonce"] = "0394852-3190485-2490358"
+	claims["https://example.com/roles"] = []string{"admin"}
+	actual, err := VerifyGoogleIDToken(signTestToken(t, nil, claims), testCerts(t), testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Claims["nonce"] != "0394852-3190485-2490358" {
+		t.Errorf("got %v\nwant %q", actual.Claims["nonce"], "0394852-3190485-2490358")
+	}
+	roles, ok := actual.Claims["https://example.com/roles"].([]interface{})
+	if !ok || len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("got %v\nwant [admin]", actual.Claims["https://example.com/roles"])
+	}
+	if actual.Claims["sub"] != actual.Sub {
+		t.Errorf("got %v\nwant %q", actual.Claims["sub"], actual.Sub)
+	}
+}
+
+func TestVerifyGoogleIDTokenNonce(t *testing.T) {
+	claims := testClaims()
+	claims["nonce"] = "n-0S6_WzA2Mj"
+	authToken := signTestToken(t, nil, claims)
+	tests := []struct {
+		name     string
+		nonce    string
+		expected error
+	}{
+		{"match", "n-0S6_WzA2Mj", nil},
+		{"mismatch", "n-0S6_WzA2Mk", ErrorTokenInvalidNonce},
+		{"no nonce expected", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := VerifyGoogleIDTokenWithOptions(authToken, testCerts(t), testAud, VerifyOptions{ExpectedNonce: tt.nonce})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Nonce != "n-0S6_WzA2Mj" {
+				t.Errorf("got %q\nwant %q", actual.Nonce, "n-0S6_WzA2Mj")
+			}
+		})
+	}
+
+	_, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, testClaims()), testCerts(t), testAud, VerifyOptions{ExpectedNonce: "n-0S6_WzA2Mj"})
+	if !errors.Is(err, ErrorTokenInvalidNonce) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidNonce)
+	}
+}
+
+func TestGetCertsFromCustomURLChunkedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, line := range strings.SplitAfter(googleCertsJSON, "\n") {
+			w.Write([]byte(line))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+
+	actual, err := GetCertsFromCustomURL(ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if string(actual) != googleCertsJSON {
+		t.Errorf("got %q\nwant %q", actual, googleCertsJSON)
+	}
+}
+
+func TestVerifyGoogleIDTokenIssuers(t *testing.T) {
+	firebase := "https://securetoken.google.com/my-project"
+	tests := []struct {
+		name     string
+		iss      string
+		issuers  []string
+		expected error
+	}{
+		{"default google", "https://accounts.google.com", nil, nil},
+		{"default google without scheme", "accounts.google.com", nil, nil},
+		{"default rejects custom", firebase, nil, ErrorTokenInvalidISS},
+		{"custom", firebase, []string{"https://id.example.com", firebase}, nil},
+		{"custom rejects google", "https://accounts.google.com", []string{firebase}, ErrorTokenInvalidISS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			claims["iss"] = tt.iss
+			_, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, claims), testCerts(t), testAud, VerifyOptions{ExpectedIssuers: tt.issuers})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAudienceUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected Audience
+	}{
+		{`{"aud":"` + testAud + `"}`, Audience{testAud}},
+		{`{"aud":["` + testAud + `","other"]}`, Audience{testAud, "other"}},
+		{`{"aud":[]}`, Audience{}},
+		{`{}`, nil},
+	}
+	for _, tt := range tests {
+		var tokeninfo TokenInfo
+		if err := json.Unmarshal([]byte(tt.json), &tokeninfo); err != nil {
+			t.Fatalf("%s: got %v\nwant nil", tt.json, err)
+		}
+		if len(tokeninfo.Aud) != len(tt.expected) {
+			t.Fatalf("%s: got %q\nwant %q", tt.json, tokeninfo.Aud, tt.expected)
+		}
+		for i := range tt.expected {
+			if tokeninfo.Aud[i] != tt.expected[i] {
+				t.Errorf("%s: got %q\nwant %q", tt.json, tokeninfo.Aud, tt.expected)
+			}
+		}
+	}
+
+	var tokeninfo TokenInfo
+	if err := json.Unmarshal([]byte(`{"aud":42}`), &tokeninfo); err == nil {
+		t.Errorf("got nil\nwant error for numeric aud")
+	}
+}
+
+func TestVerifyGoogleIDTokenAudienceArray(t *testing.T) {
+	tests := []struct {
+		name     string
+		aud      interface{}
+		expected error
+	}{
+		{"string", testAud, nil},
+		{"array", []string{"other.apps.googleusercontent.com", testAud}, nil},
+		{"array without match", []string{"other.apps.googleusercontent.com"}, ErrorTokenInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			claims["aud"] = tt.aud
+			_, err := VerifyGoogleIDToken(signTestToken(t, nil, claims), testCerts(t), testAud)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConstantTimeEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{testAud, testAud, true},
+		{"", "", true},
+		{testAud, testAud + "x", false},
+		{testAud, testAud[:len(testAud)-1], false},
+		{"accounts.google.com", "accounts.google.co", false},
+		{"accounts.google.com", "accounts.google.con", false},
+		{"", "accounts.google.com", false},
+	}
+	for _, tt := range tests {
+		if actual := constantTimeEqual(tt.a, tt.b); actual != tt.expected {
+			t.Errorf("constantTimeEqual(%q, %q): got %v\nwant %v", tt.a, tt.b, actual, tt.expected)
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenSignatureLength(t *testing.T) {
+	authToken := signTestToken(t, nil, testClaims())
+	signingInput := authToken[:strings.LastIndex(authToken, ".")]
+	signature := authToken[strings.LastIndex(authToken, ".")+1:]
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"empty", ""},
+		{"truncated", signature[:len(signature)/2]},
+		{"oversized", signature + signature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := VerifyGoogleIDToken(signingInput+"."+tt.signature, testCerts(t), testAud)
+			if !errors.Is(err, ErrorTokenMalformedSignature) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenMalformedSignature)
+			}
+			if actual != nil {
+				t.Errorf("got %v\nwant nil", actual)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenForgedSignature(t *testing.T) {
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	header := map[string]interface{}{"alg": "RS256", "kid": testKeyID, "typ": "JWT"}
+	authToken := encodeTestToken(t, header, testClaims(), func(digest []byte) []byte {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, forger, crypto.SHA256, digest)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return sig
+	})
+
+	actual, err := VerifyGoogleIDToken(authToken, testCerts(t), testAud)
+	if !errors.Is(err, ErrorTokenSignatureInvalid) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenSignatureInvalid)
+	}
+	if !errors.Is(err, rsa.ErrVerification) {
+		t.Errorf("got %v\nwant wrapped %v", err, rsa.ErrVerification)
+	}
+	if actual != nil {
+		t.Errorf("got %v\nwant nil", actual)
+	}
+}
+
+func TestParsePublicKeyExponent(t *testing.T) {
+	tests := []struct {
+		e        string
+		expected int
+	}{
+		{"AQAB", 65537},
+		{"Aw", 3},
+		{"AAEAAQ", 65537},
+		{"AAAAAAAAAAAAAQAB", 65537},
+		{"AQAAAAAB", 1<<40 + 1},
+	}
+	for _, tt := range tests {
+		pub, err := parsePublicKey(&Key{Kty: "RSA", N: testCerts(t).Keys[0].N, E: tt.e})
+		if err != nil {
+			t.Fatalf("%s: got %v\nwant nil", tt.e, err)
+		}
+		if actual := pub.(*rsa.PublicKey).E; actual != tt.expected {
+			t.Errorf("%s: got %d\nwant %d", tt.e, actual, tt.expected)
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenKeySize(t *testing.T) {
+	tests := []struct {
+		bits     int
+		expected error
+	}{
+		{1024, ErrorWeakSigningKey},
+		{2048, nil},
+	}
+	for _, tt := range tests {
+		priv, err := rsa.GenerateKey(rand.Reader, tt.bits)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		authToken, certs, err := GenerateTestToken(priv, testKeyID, TokenInfo{Aud: Audience{testAud}, Iss: "https://accounts.google.com"})
+		if err != nil {
+			t.Fatalf("generate token: %v", err)
+		}
+		if _, err := VerifyGoogleIDToken(authToken, certs, testAud); !errors.Is(err, tt.expected) {
+			t.Errorf("%d bits: got %v\nwant %v", tt.bits, err, tt.expected)
+		}
+	}
+}
+
+func TestParsePublicKeyExponentTooLarge(t *testing.T) {
+	_, err := parsePublicKey(&Key{Kty: "RSA", N: testCerts(t).Keys[0].N, E: "AQAAAAAAAAAAAQ"})
+	if !errors.Is(err, ErrorCertsMalformed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsMalformed)
+	}
+}
+
+func BenchmarkVerifySignaturePerToken(b *testing.B) {
+	authToken := signTestToken(b, nil, testClaims())
+	_, _, signature, messageToSign, _ := divideAuthToken(authToken)
+	key := &testCerts(b).Keys[0]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pub, err := parsePublicKey(key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := verifySignature(pub, "RS256", messageToSign, signature); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifySignatureCachedKey(b *testing.B) {
+	authToken := signTestToken(b, nil, testClaims())
+	_, _, signature, messageToSign, _ := divideAuthToken(authToken)
+	pub, err := parsePublicKey(&testCerts(b).Keys[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := verifySignature(pub, "RS256", messageToSign, signature); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCertsPublicKey(t *testing.T) {
+	certs := mustGetCerts(t, googleCertsJSON)
+	if len(certs.publicKeys) != 2 {
+		t.Fatalf("got %d parsed keys\nwant 2", len(certs.publicKeys))
+	}
+	first, err := certs.publicKey("6f7254101f56e41cf35c9926de84a2d552b4c6f1")
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	second, err := certs.publicKey("6f7254101f56e41cf35c9926de84a2d552b4c6f1")
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if first != second {
+		t.Errorf("got a new key on each lookup\nwant the key parsed once")
+	}
+	if _, err := certs.publicKey("unknown"); !errors.Is(err, ErrorTokenInvalidKey) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+	}
+}
+
+func BenchmarkVerifyGoogleIDTokenParsedKeys(b *testing.B) {
+	authToken := signTestToken(b, nil, testClaims())
+	certs := testCerts(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyGoogleIDToken(authToken, certs, testAud); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyGoogleIDTokenUnparsedKeys(b *testing.B) {
+	authToken := signTestToken(b, nil, testClaims())
+	keys := testCerts(b).Keys
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyGoogleIDToken(authToken, &Certs{Keys: keys}, testAud); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNumericDateUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected NumericDate
+	}{
+		{`{"iat":1700000000,"exp":1700003600}`, 1700000000},
+		{`{"iat":"1700000000","exp":"1700003600"}`, 1700000000},
+		{`{"iat":1.7e9,"exp":1700003600}`, 1700000000},
+		{`{"iat":" 1700000000 ","exp":"1700003600"}`, 1700000000},
+	}
+	for _, tt := range tests {
+		var tokeninfo TokenInfo
+		if err := json.Unmarshal([]byte(tt.json), &tokeninfo); err != nil {
+			t.Fatalf("%s: got %v\nwant nil", tt.json, err)
+		}
+		if tokeninfo.Iat != tt.expected {
+			t.Errorf("%s: got %d\nwant %d", tt.json, tokeninfo.Iat, tt.expected)
+		}
+		if tokeninfo.Exp != 1700003600 {
+			t.Errorf("%s: got %d\nwant %d", tt.json, tokeninfo.Exp, 1700003600)
+		}
+	}
+
+	for _, invalid := range []string{`{"exp":"soon"}`, `{"exp":true}`, `{"exp":1e30}`, `{"exp":-1e30}`, `{"exp":"9.3e18"}`} {
+		var tokeninfo TokenInfo
+		if err := json.Unmarshal([]byte(invalid), &tokeninfo); err == nil {
+			t.Errorf("%s: got nil\nwant error", invalid)
+		}
+	}
+}
+
+func TestBoolClaimUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected BoolClaim
+	}{
+		{`{"email_verified":true}`, true},
+		{`{"email_verified":false}`, false},
+		{`{"email_verified":"true"}`, true},
+		{`{"email_verified":"false"}`, false},
+		{`{"email_verified":" TRUE "}`, true},
+		{`{"email_verified":null}`, false},
+		{`{}`, false},
+	}
+	for _, tt := range tests {
+		var tokeninfo TokenInfo
+		if err := json.Unmarshal([]byte(tt.json), &tokeninfo); err != nil {
+			t.Fatalf("%s: got %v\nwant nil", tt.json, err)
+		}
+		if tokeninfo.EmailVerified != tt.expected {
+			t.Errorf("%s: got %v\nwant %v", tt.json, tokeninfo.EmailVerified, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{`{"email_verified":"yes"}`, `{"email_verified":1}`} {
+		var tokeninfo TokenInfo
+		if err := json.Unmarshal([]byte(invalid), &tokeninfo); err == nil {
+			t.Errorf("%s: got nil\nwant error", invalid)
+		}
+	}
+
+	claims := testClaims()
+	claims["email_verified"] = "true"
+	if _, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, claims), testCerts(t), testAud, VerifyOptions{RequireEmailVerified: true}); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+}
+
+func TestVerifyGoogleIDTokenStringDates(t *testing.T) {
+	claims := testClaims()
+	claims["iat"] = fmt.Sprint(claims["iat"])
+	claims["exp"] = fmt.Sprint(claims["exp"])
+	if _, err := VerifyGoogleIDToken(signTestToken(t, nil, claims), testCerts(t), testAud); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+}
+
+func TestVerifyGoogleIDTokenNotBefore(t *testing.T) {
+	leeway := time.Minute
+	tests := []struct {
+		name     string
+		nbf      time.Duration
+		leeway   time.Duration
+		expected error
+	}{
+		{"reached", -time.Second, 0, nil},
+		{"not reached", 5 * time.Second, 0, ErrorTokenNotYetValid},
+		{"within leeway", leeway - 5*time.Second, leeway, nil},
+		{"beyond leeway", leeway + 5*time.Second, leeway, ErrorTokenNotYetValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			claims["iat"] = time.Now().Add(-time.Minute).Unix()
+			claims["nbf"] = time.Now().Add(tt.nbf).Unix()
+			_, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, claims), testCerts(t), testAud, VerifyOptions{Leeway: tt.leeway})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+
+	if _, err := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), testCerts(t), testAud); err != nil {
+		t.Errorf("got %v\nwant nil for token without nbf", err)
+	}
+}
+
+func TestCalcSum(t *testing.T) {
+	// The "abc" test vectors from FIPS 180-2
+	tests := []struct {
+		hash     crypto.Hash
+		expected string
+	}{
+		{crypto.SHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{crypto.SHA384, "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7"},
+		{crypto.SHA512, "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hash.String(), func(t *testing.T) {
+			if actual := hex.EncodeToString(calcSum("abc", tt.hash)); actual != tt.expected {
+				t.Errorf("got %v\nwant %v", actual, tt.expected)
+			}
+		})
+	}
+
+	for alg, hash := range algorithmHashes {
+		if actual := len(calcSum("abc", hash)); actual != hash.Size() {
+			t.Errorf("%s: got %d bytes\nwant %d", alg, actual, hash.Size())
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenMissingAudience(t *testing.T) {
+	tests := []struct {
+		name    string
+		aud     interface{}
+		missing bool
+	}{
+		{"absent", nil, true},
+		{"empty string", "", true},
+		{"empty array", []string{}, true},
+		{"array of empty strings", []string{""}, true},
+		{"mismatched", "other.apps.googleusercontent.com", false},
+		{"mismatched array", []string{"", "other.apps.googleusercontent.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			delete(claims, "aud")
+			if tt.aud != nil {
+				claims["aud"] = tt.aud
+			}
+			_, err := VerifyGoogleIDToken(signTestToken(t, nil, claims), testCerts(t), testAud)
+			if actual := errors.Is(err, ErrorTokenMissingAudience); actual != tt.missing {
+				t.Errorf("got %v\nwant missing audience %v", err, tt.missing)
+			}
+			// Callers checking for a wrong audience still catch a missing one
+			if !errors.Is(err, ErrorTokenInvalidAudience) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenEmptyExpectedAudience(t *testing.T) {
+	tests := []struct {
+		name string
+		aud  interface{}
+	}{
+		{"empty string", ""},
+		{"empty element", []string{"", "evil.apps.googleusercontent.com"}},
+		{"other audience", "evil.apps.googleusercontent.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			claims["aud"] = tt.aud
+			token := signTestToken(t, nil, claims)
+			if _, err := VerifyGoogleIDToken(token, testCerts(t), ""); !errors.Is(err, ErrorTokenInvalidAudience) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+			}
+			opts := VerifyOptions{Audiences: []string{""}}
+			if _, err := VerifyGoogleIDTokenWithOptions(token, testCerts(t), "", opts); !errors.Is(err, ErrorTokenInvalidAudience) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+			}
+		})
+	}
+}
+
+func TestTokenInfoAudiences(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected []string
+	}{
+		{`{"aud":"` + testAud + `"}`, []string{testAud}},
+		{`{"aud":["` + testAud + `","other"]}`, []string{testAud, "other"}},
+		{`{}`, nil},
+	}
+	for _, tt := range tests {
+		var tokeninfo TokenInfo
+		if err := json.Unmarshal([]byte(tt.json), &tokeninfo); err != nil {
+			t.Fatalf("%s: got %v\nwant nil", tt.json, err)
+		}
+		actual := tokeninfo.Audiences()
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: got %q\nwant %q", tt.json, actual, tt.expected)
+		}
+		if len(actual) > 0 {
+			actual[0] = "changed"
+			if tokeninfo.Aud[0] == "changed" {
+				t.Errorf("%s: got %q\nwant Audiences to return a copy", tt.json, tokeninfo.Aud)
+			}
+		}
+	}
+}
+
+func TestTokenInfoExpiresIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		exp     time.Duration
+		expired bool
+	}{
+		{"already expired", -time.Hour, true},
+		{"far future", 365 * 24 * time.Hour, false},
+		{"boundary", 2 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokeninfo := &TokenInfo{Exp: NumericDate(time.Now().Add(tt.exp).Unix())}
+			if actual := tokeninfo.ExpiresIn(); actual < tt.exp-time.Second || actual > tt.exp {
+				t.Errorf("got %v\nwant about %v", actual, tt.exp)
+			}
+			if actual := tokeninfo.IsExpired(); actual != tt.expired {
+				t.Errorf("got %v\nwant %v", actual, tt.expired)
+			}
+		})
+	}
+
+	tokeninfo := &TokenInfo{Exp: NumericDate(time.Now().Add(-time.Second).Unix())}
+	if !tokeninfo.IsExpired() || tokeninfo.ExpiresIn() >= 0 {
+		t.Errorf("got expired %v, expires in %v\nwant expired", tokeninfo.IsExpired(), tokeninfo.ExpiresIn())
+	}
+}
+
+func TestValidateTimes(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(d time.Duration) NumericDate { return NumericDate(now.Add(d).Unix()) }
+	fixed := func(tm time.Time) func() time.Time { return func() time.Time { return tm } }
+	tests := []struct {
+		name     string
+		nbf      NumericDate
+		iat      NumericDate
+		exp      NumericDate
+		leeway   time.Duration
+		asOf     time.Time
+		expected error
+	}{
+		{"valid", 0, at(-time.Minute), at(time.Hour), 0, time.Time{}, nil},
+		{"valid with nbf", at(-time.Minute), at(-time.Minute), at(time.Hour), 0, time.Time{}, nil},
+		{"nbf now", at(0), at(-time.Minute), at(time.Hour), 0, time.Time{}, nil},
+		{"nbf ahead", at(time.Minute), at(-time.Minute), at(time.Hour), 0, time.Time{}, ErrorTokenNotYetValid},
+		{"nbf ahead within leeway", at(30 * time.Second), at(-time.Minute), at(time.Hour), time.Minute, time.Time{}, nil},
+		{"nbf ahead beyond leeway", at(2 * time.Minute), at(-time.Minute), at(time.Hour), time.Minute, time.Time{}, ErrorTokenNotYetValid},
+		{"iat now", 0, at(0), at(time.Hour), 0, time.Time{}, nil},
+		{"iat ahead", 0, at(time.Second), at(time.Hour), 0, time.Time{}, ErrorTokenUsedBeforeIssued},
+		{"iat ahead within leeway", 0, at(30 * time.Second), at(time.Hour), time.Minute, time.Time{}, nil},
+		{"iat ahead beyond leeway", 0, at(2 * time.Minute), at(time.Hour), time.Minute, time.Time{}, ErrorTokenUsedBeforeIssued},
+		{"exp now", 0, at(-time.Hour), at(0), 0, time.Time{}, nil},
+		{"exp passed", 0, at(-time.Hour), at(-time.Second), 0, time.Time{}, ErrorTokenExpired},
+		{"exp passed within leeway", 0, at(-time.Hour), at(-30 * time.Second), time.Minute, time.Time{}, nil},
+		{"exp passed beyond leeway", 0, at(-time.Hour), at(-2 * time.Minute), time.Minute, time.Time{}, ErrorTokenExpired},
+		{"missing exp", 0, at(-time.Hour), 0, 0, time.Time{}, ErrorTokenExpired},
+		{"nbf checked before iat", at(time.Minute), at(time.Minute), at(time.Hour), 0, time.Time{}, ErrorTokenNotYetValid},
+		{"iat checked before exp", 0, at(time.Minute), at(-time.Minute), 0, time.Time{}, ErrorTokenUsedBeforeIssued},
+		{"as of, valid then", 0, at(-2 * time.Hour), at(-time.Hour), 0, now.Add(-90 * time.Minute), nil},
+		{"as of, not yet issued then", 0, at(-time.Hour), at(time.Hour), 0, now.Add(-2 * time.Hour), ErrorTokenUsedBeforeIssued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokeninfo := &TokenInfo{Nbf: tt.nbf, Iat: tt.iat, Exp: tt.exp}
+			opts := VerifyOptions{Leeway: tt.leeway, Now: fixed(now), AsOf: tt.asOf}
+			if err := validateTimes(tokeninfo, opts); !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+
+	// Without Now or AsOf, the wall clock is used
+	tokeninfo := &TokenInfo{Iat: NumericDate(time.Now().Add(-time.Minute).Unix()), Exp: NumericDate(time.Now().Add(time.Hour).Unix())}
+	if err := validateTimes(tokeninfo, VerifyOptions{}); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+	if err := validateTimes(tokeninfo, VerifyOptions{Now: fixed(time.Now().Add(2 * time.Hour))}); !errors.Is(err, ErrorTokenExpired) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenExpired)
+	}
+}
+
+func TestTokenInfoValid(t *testing.T) {
+	iat := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	tokeninfo := &TokenInfo{
+		Iat: NumericDate(iat.Unix()),
+		Nbf: NumericDate(iat.Add(time.Minute).Unix()),
+		Exp: NumericDate(iat.Add(time.Hour).Unix()),
+	}
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected error
+	}{
+		{"before iat", iat.Add(-time.Second), ErrorTokenNotYetValid},
+		{"at iat, before nbf", iat, ErrorTokenNotYetValid},
+		{"at nbf", iat.Add(time.Minute), nil},
+		{"at exp", iat.Add(time.Hour), nil},
+		{"after exp", iat.Add(time.Hour + time.Second), ErrorTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tokeninfo.Valid(tt.now); !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+
+	// Without nbf, iat is the earliest time the token is valid
+	withoutNbf := *tokeninfo
+	withoutNbf.Nbf = 0
+	if err := withoutNbf.Valid(iat.Add(-time.Second)); !errors.Is(err, ErrorTokenUsedBeforeIssued) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenUsedBeforeIssued)
+	}
+	if err := withoutNbf.Valid(iat); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+}
+
+func TestVerifyGoogleIDTokenEmailVerified(t *testing.T) {
+	certs := testCerts(t)
+	tests := []struct {
+		name     string
+		verified interface{}
+		require  bool
+		expected error
+	}{
+		{"verified", true, true, nil},
+		{"unverified", false, true, ErrorTokenEmailNotVerified},
+		{"missing", nil, true, ErrorTokenEmailNotVerified},
+		{"unverified not required", false, false, nil},
+		{"missing not required", nil, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			if tt.verified != nil {
+				claims["email_verified"] = tt.verified
+			}
+			_, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, claims), certs, testAud, VerifyOptions{RequireEmailVerified: tt.require})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetTokenInfoProfileClaims(t *testing.T) {
+	payload := []byte(`{
+		"sub": "110169484474386276334",
+		"name": "Test User",
+		"given_name": "Test",
+		"family_name": "User",
+		"picture": "https://lh3.googleusercontent.com/a/photo.jpg",
+		"profile": "https://plus.google.com/110169484474386276334",
+		"locale": "en-GB"
+	}`)
+	actual, err := getTokenInfo(payload)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := TokenInfo{
+		Sub:        "110169484474386276334",
+		Name:       "Test User",
+		GivenName:  "Test",
+		FamilyName: "User",
+		Picture:    "https://lh3.googleusercontent.com/a/photo.jpg",
+		Profile:    "https://plus.google.com/110169484474386276334",
+		Locale:     "en-GB",
+	}
+	actual.Claims = nil
+	if !reflect.DeepEqual(*actual, expected) {
+		t.Errorf("got %+v\nwant %+v", *actual, expected)
+	}
+}
+
+func TestTokenInfoString(t *testing.T) {
+	tokeninfo := &TokenInfo{
+		Sub:     "110169484474386276334",
+		Email:   "testuser@gmail.com",
+		Name:    "Test User",
+		Picture: "https://lh3.googleusercontent.com/a/photo.jpg",
+		Iss:     "https://accounts.google.com",
+		Exp:     NumericDate(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Unix()),
+	}
+	expected := "TokenInfo{sub: 1101..., email: t...@gmail.com, iss: https://accounts.google.com, exp: 2026-01-02T03:04:05Z}"
+	embedded := struct {
+		TokenInfo
+		Scope string
+	}{*tokeninfo, "email"}
+	for _, actual := range []string{tokeninfo.String(), fmt.Sprintf("%v", tokeninfo), fmt.Sprintf("%+v", tokeninfo),
+		fmt.Sprintf("%v", *tokeninfo), fmt.Sprintf("%+v", *tokeninfo), fmt.Sprintf("%+v", embedded)} {
+		if actual != expected {
+			t.Errorf("got %v\nwant %v", actual, expected)
+		}
+		for _, secret := range []string{tokeninfo.Sub, tokeninfo.Email, "testuser", tokeninfo.Name, tokeninfo.Picture} {
+			if strings.Contains(actual, secret) {
+				t.Errorf("got %v\nwant %q redacted", actual, secret)
+			}
+		}
+	}
+	if actual := fmt.Sprintf("%v", (*TokenInfo)(nil)); actual != "<nil>" {
+		t.Errorf("got %v\nwant <nil>", actual)
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"testuser@gmail.com", "t...@gmail.com"},
+		{"a@example.com", "*@example.com"},
+		{"no-at-sign", "..."},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if actual := maskEmail(tt.email); actual != tt.expected {
+			t.Errorf("got %v\nwant %v", actual, tt.expected)
+		}
+	}
+}
+
+func TestVerifyAtHash(t *testing.T) {
+	// Example from the OpenID Connect Core 1.0 specification, appendix A.4
+	accessToken := "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"
+	claims := testClaims()
+	claims["at_hash"] = "77QmUPtjPfzWtF2AnpK9RQ"
+	idToken := signTestToken(t, nil, claims)
+	tokeninfo, err := VerifyGoogleIDToken(idToken, testCerts(t), testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+
+	if err := VerifyAtHash(tokeninfo, idToken, accessToken); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+	if err := VerifyAtHash(tokeninfo, idToken, accessToken+"x"); !errors.Is(err, ErrorTokenInvalidAtHash) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAtHash)
+	}
+	if err := VerifyAtHash(&TokenInfo{}, idToken, accessToken); !errors.Is(err, ErrorTokenInvalidAtHash) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAtHash)
+	}
+	if err := VerifyAtHash(tokeninfo, "XXX", accessToken); !errors.Is(err, ErrorTokenMalformed) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenMalformed)
+	}
+	hs256 := signTestToken(t, map[string]interface{}{"alg": "HS256", "kid": testKeyID}, claims)
+	if err := VerifyAtHash(tokeninfo, hs256, accessToken); !errors.Is(err, ErrorTokenUnsupportedAlgorithm) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenUnsupportedAlgorithm)
+	}
+
+	// RS384 and RS512 tokens hash the access token with SHA-384 and SHA-512
+	for _, alg := range []string{"RS384", "RS512"} {
+		sum := calcSum(accessToken, algorithmHashes[alg])
+		claims["at_hash"] = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+		idToken := signTestToken(t, map[string]interface{}{"alg": alg, "kid": testKeyID}, claims)
+		certs := testCerts(t)
+		certs.Keys[0].Alg = alg
+		tokeninfo, err := VerifyGoogleIDToken(idToken, certs, testAud)
+		if err != nil {
+			t.Fatalf("%s: got %v\nwant nil", alg, err)
+		}
+		if err := VerifyAtHash(tokeninfo, idToken, accessToken); err != nil {
+			t.Errorf("%s: got %v\nwant nil", alg, err)
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenType(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      interface{}
+		strict   bool
+		expected error
+	}{
+		{"JWT", "JWT", true, nil},
+		{"lowercase jwt", "jwt", true, nil},
+		{"wrong type", "at+jwt", true, ErrorTokenInvalidType},
+		{"absent type", nil, true, nil},
+		{"wrong type without strict mode", "at+jwt", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]interface{}{"alg": "RS256", "kid": testKeyID}
+			if tt.typ != nil {
+				header["typ"] = tt.typ
+			}
+			_, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, header, testClaims()), testCerts(t), testAud, VerifyOptions{RequireJWTType: tt.strict})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenMalformedPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"invalid json", `{"aud":`},
+		{"not an object", `["aud"]`},
+		{"null", `null`},
+		{"wrong claim type", `{"iss":42}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"` + testKeyID + `"}`))
+			authToken := header + "." + base64.RawURLEncoding.EncodeToString([]byte(tt.payload)) + ".c2ln"
+			actual, err := VerifyGoogleIDToken(authToken, testCerts(t), testAud)
+			if !errors.Is(err, ErrorTokenMalformedPayload) {
+				t.Errorf("got %v\nwant %v", err, ErrorTokenMalformedPayload)
+			}
+			if actual != nil {
+				t.Errorf("got %v\nwant nil", actual)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenMalformedHeader(t *testing.T) {
+	claims, _ := json.Marshal(testClaims())
+	tests := []struct {
+		name     string
+		header   string
+		expected error
+	}{
+		{"invalid json", `{"alg":"RS256",`, ErrorTokenMalformedHeader},
+		{"null", `null`, ErrorTokenMalformedHeader},
+		{"not an object", `"RS256"`, ErrorTokenMalformedHeader},
+		{"missing kid", `{"alg":"RS256","typ":"JWT"}`, ErrorTokenMissingKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authToken := base64.RawURLEncoding.EncodeToString([]byte(tt.header)) + "." + base64.RawURLEncoding.EncodeToString(claims) + ".c2ln"
+			actual, err := VerifyGoogleIDToken(authToken, testCerts(t), testAud)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+			if actual != nil {
+				t.Errorf("got %v\nwant nil", actual)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenKeyID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   map[string]interface{}
+		expected error
+	}{
+		{"missing kid", map[string]interface{}{"alg": "RS256"}, ErrorTokenMissingKeyID},
+		{"empty kid", map[string]interface{}{"alg": "RS256", "kid": ""}, ErrorTokenMissingKeyID},
+		{"unknown kid", map[string]interface{}{"alg": "RS256", "kid": "rotated-in"}, ErrorTokenInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authToken := signTestToken(t, tt.header, testClaims())
+			_, err := VerifyGoogleIDToken(authToken, testCerts(t), testAud)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+			if _, err := KeyID(authToken); tt.expected == ErrorTokenMissingKeyID && !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+
+	kid, err := KeyID(signTestToken(t, nil, testClaims()))
+	if err != nil || kid != testKeyID {
+		t.Errorf("got %q, %v\nwant %q, nil", kid, err, testKeyID)
+	}
+	if _, err := KeyID("garbage"); !errors.Is(err, ErrorTokenMalformed) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenMalformed)
+	}
+}
+
+func TestVerifyWithCertBytes(t *testing.T) {
+	certBytes, err := json.Marshal(testCerts(t))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	authToken := signTestToken(t, nil, testClaims())
+	actual, err := VerifyWithCertBytes(authToken, testAud, certBytes)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+
+	for _, corrupt := range []string{"", "<html>", `{"keys":`} {
+		actual, err := VerifyWithCertBytes(authToken, testAud, []byte(corrupt))
+		if !errors.Is(err, ErrorCertsMalformed) {
+			t.Errorf("%q: got %v\nwant %v", corrupt, err, ErrorCertsMalformed)
+		}
+		if actual != nil {
+			t.Errorf("%q: got %v\nwant nil", corrupt, actual)
+		}
+	}
+}
+
+func TestGetCertsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"empty", ""},
+		{"not json", "<!DOCTYPE html><html></html>"},
+		{"null", "null"},
+		{"missing keys", `{"kty":"RSA"}`},
+		{"null keys", `{"keys":null}`},
+		{"keys not an array", `{"keys":{"kid":"1"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, parse := range []func(string) (*Certs, error){
+				func(document string) (*Certs, error) { return GetCerts([]byte(document)) },
+				func(document string) (*Certs, error) { return GetCertsFromReader(strings.NewReader(document)) },
+			} {
+				certs, err := parse(tt.document)
+				if !errors.Is(err, ErrorCertsMalformed) {
+					t.Errorf("got %v\nwant %v", err, ErrorCertsMalformed)
+				}
+				if certs != nil {
+					t.Errorf("got %v\nwant nil", certs)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCertsFromReader(t *testing.T) {
+	certs, err := GetCertsFromReader(strings.NewReader(googleCertsJSON))
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := mustGetCerts(t, googleCertsJSON)
+	if !reflect.DeepEqual(certs.Keys, expected.Keys) {
+		t.Errorf("got %+v\nwant %+v", certs.Keys, expected.Keys)
+	}
+	if len(certs.publicKeys) != 2 {
+		t.Errorf("got %d parsed keys\nwant 2", len(certs.publicKeys))
+	}
+}
+
+func BenchmarkGetCertsBuffered(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bt, err := io.ReadAll(strings.NewReader(googleCertsJSON))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := GetCerts(bt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetCertsFromReader(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetCertsFromReader(strings.NewReader(googleCertsJSON)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	expired := testClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	f.Add(signTestToken(f, nil, testClaims()))
+	f.Add(signTestToken(f, nil, expired))
+	f.Add(signTestToken(f, map[string]interface{}{"alg": "ES256", "kid": testKeyID}, testClaims()))
+	f.Add("XXXXXXXXXXX.XXXXXXXXXXXX.XXXXXXXXXX")
+	f.Add("..")
+	f.Add("")
+	certs := testCerts(f)
+	f.Fuzz(func(t *testing.T, authToken string) {
+		tokeninfo, err := VerifyGoogleIDToken(authToken, certs, testAud)
+		if (err == nil) == (tokeninfo == nil) {
+			t.Errorf("got %v, %v\nwant either a TokenInfo or an error", tokeninfo, err)
+		}
+		if claims, err := VerifyJWT(authToken, certs); (err == nil) == (claims == nil) {
+			t.Errorf("got %v, %v\nwant either claims or an error", claims, err)
+		}
+	})
+}
+
+func FuzzDivideAuthToken(f *testing.F) {
+	f.Add(signTestToken(f, nil, testClaims()))
+	f.Add("XXXXXXXXXXX.XXXXXXXXXXXX.XXXXXXXXXX")
+	f.Add("a.b")
+	f.Add("a.b.c.d")
+	f.Fuzz(func(t *testing.T, authToken string) {
+		_, _, _, _, err := divideAuthToken(authToken)
+		if strings.Count(authToken, ".") != 2 && err == nil {
+			t.Errorf("%q: got nil\nwant an error without exactly three parts", authToken)
+		}
+		if err != nil && !errors.Is(err, ErrorTokenMalformed) {
+			t.Errorf("%q: got %v\nwant %v", authToken, err, ErrorTokenMalformed)
+		}
+	})
+}
+
+func FuzzGetCerts(f *testing.F) {
+	f.Add([]byte(googleCertsJSON))
+	f.Add([]byte(`{"keys":[{"kty":"EC","crv":"P-256","kid":"ec","x":"AQ","y":"AQ"}]}`))
+	f.Add([]byte(`{"keys":[{"kty":"RSA","kid":"rsa","n":"","e":""}]}`))
+	f.Add([]byte(`{"keys":null}`))
+	authToken := signTestToken(f, nil, testClaims())
+	f.Fuzz(func(t *testing.T, document []byte) {
+		certs, err := GetCerts(document)
+		if err != nil {
+			if certs != nil {
+				t.Errorf("got %v\nwant nil alongside %v", certs, err)
+			}
+			return
+		}
+		if certs.Keys == nil {
+			t.Errorf("got nil keys\nwant an error")
+		}
+		for _, kid := range certs.KeyIDs() {
+			certs.publicKey(kid)
+		}
+		VerifyGoogleIDToken(authToken, certs, testAud)
+	})
+}
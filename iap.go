@@ -0,0 +1,35 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"fmt"
+)
+
+// iapCertsURL serves the keys Identity-Aware Proxy signs its assertions with, as a JWKS document of ES256 keys
+const iapCertsURL = "https://www.gstatic.com/iap/verify/public_key-jwk"
+
+// iapIssuer is the issuer of an Identity-Aware Proxy assertion
+const iapIssuer = "https://cloud.google.com/iap"
+
+// iapCertCache backs VerifyIAPToken. IAP's keys are separate from those of Google Sign-In
+var iapCertCache = &CertCache{URL: iapCertsURL}
+
+// VerifyIAPToken verifies the signed header JWT Identity-Aware Proxy adds to requests it forwards, x-goog-iap-jwt-assertion.
+// expectedAudience names the protected resource, such as /projects/PROJECT_NUMBER/global/backendServices/SERVICE_ID
+// or /projects/PROJECT_NUMBER/apps/PROJECT_ID. Besides the signature and expiry, the token's iss must be IAP's
+// and its sub must be non-empty. The certs are cached until they expire
+func VerifyIAPToken(ctx context.Context, authToken string, expectedAudience string) (*TokenInfo, error) {
+	return verifyIAPToken(ctx, authToken, expectedAudience, iapCertCache)
+}
+
+func verifyIAPToken(ctx context.Context, authToken string, expectedAudience string, provider KeyProvider) (*TokenInfo, error) {
+	if expectedAudience == "" {
+		return nil, fmt.Errorf("%w: expected audience is empty", ErrorTokenInvalidAudience)
+	}
+	return VerifyWithOptions(ctx, authToken, VerifyOptions{
+		Audiences:       []string{expectedAudience},
+		ExpectedIssuers: []string{iapIssuer},
+		RequireSubject:  true,
+		KeyProvider:     provider,
+	})
+}
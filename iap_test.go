@@ -0,0 +1,100 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testIAPAudience = "/projects/123456789/global/backendServices/987654321"
+
+// testIAPClaims returns claims shaped like those Identity-Aware Proxy asserts for testIAPAudience
+func testIAPClaims() map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":   "https://cloud.google.com/iap",
+		"aud":   testIAPAudience,
+		"sub":   "accounts.google.com:110169484474386276334",
+		"email": "testuser@example.com",
+		"hd":    "example.com",
+		"iat":   now,
+		"exp":   now + 600,
+		"google": map[string]interface{}{
+			"access_levels": []string{"accessPolicies/1234/accessLevels/corp"},
+		},
+	}
+}
+
+// signTestIAPToken signs claims as an ES256 token with testECKey, as IAP does
+func signTestIAPToken(t *testing.T, claims map[string]interface{}) string {
+	header := map[string]interface{}{"alg": "ES256", "kid": "0oeLcQ", "typ": "JWT"}
+	return encodeTestToken(t, header, claims, func(digest []byte) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey(t), digest)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	})
+}
+
+func TestVerifyIAPToken(t *testing.T) {
+	pub := testECKey(t).PublicKey
+	// The shape served by https://www.gstatic.com/iap/verify/public_key-jwk
+	document := fmt.Sprintf(`{
+		"keys": [
+			{"alg": "ES256", "crv": "P-256", "kid": "BOIWdQ", "kty": "EC", "use": "sig", "x": "2Eo6vIIBJqUjizNnhS5pQ4hmqRtEfqJM_pCdhBQnHYw", "y": "s5BneIEU2WfDXwXdHOGpBZnwnKVjVNPxvdnzPEH5AII"},
+			{"alg": "ES256", "crv": "P-256", "kid": "0oeLcQ", "kty": "EC", "use": "sig", "x": %q, "y": %q}
+		]
+	}`, base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))), base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))))
+	var requested string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requested = r.URL.String()
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "public, max-age=3600")
+		rec.WriteString(document)
+		return rec.Result(), nil
+	})}
+	provider := &CertCache{Client: client, URL: iapCertCache.URL}
+
+	expired := testIAPClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	signIn := testIAPClaims()
+	signIn["iss"] = "https://accounts.google.com"
+	tests := []struct {
+		name      string
+		authToken string
+		audience  string
+		expected  error
+	}{
+		{"valid", signTestIAPToken(t, testIAPClaims()), testIAPAudience, nil},
+		{"other resource", signTestIAPToken(t, testIAPClaims()), "/projects/123456789/apps/other", ErrorTokenInvalidAudience},
+		{"empty audience", signTestIAPToken(t, testIAPClaims()), "", ErrorTokenInvalidAudience},
+		{"expired", signTestIAPToken(t, expired), testIAPAudience, ErrorTokenExpired},
+		{"sign-in issuer", signTestIAPToken(t, signIn), testIAPAudience, ErrorTokenInvalidISS},
+		{"sign-in key", signTestToken(t, nil, testIAPClaims()), testIAPAudience, ErrorTokenInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := verifyIAPToken(context.Background(), tt.authToken, tt.audience, provider)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Sub != "accounts.google.com:110169484474386276334" {
+				t.Errorf("got %q\nwant %q", actual.Sub, "accounts.google.com:110169484474386276334")
+			}
+		})
+	}
+	if requested != iapCertsURL {
+		t.Errorf("got %v\nwant %v", requested, iapCertsURL)
+	}
+}
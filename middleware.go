@@ -0,0 +1,55 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"net/http"
+)
+
+// Option adjusts the VerifyOptions Middleware verifies tokens with
+type Option func(*VerifyOptions)
+
+type tokenInfoKey struct{}
+
+// Middleware verifies the Bearer token in each request's Authorization header for aud.
+// Requests with a valid token are passed to next with the token's TokenInfo in their context,
+// which FromContext returns. Other requests are answered with 401 Unauthorized,
+// or 503 Service Unavailable if the certs couldn't be fetched.
+// Unless an Option sets a KeyProvider, certs are cached per Middleware, and refetched for an unknown kid at most once a minute
+func Middleware(aud string, opts ...Option) func(http.Handler) http.Handler {
+	var options VerifyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if aud != "" {
+		options.Audiences = append([]string{aud}, options.Audiences...)
+	}
+	if options.KeyProvider == nil {
+		options.KeyProvider = &CertCache{Client: options.httpClient(), Retry: options.Retry, Header: options.CertsHeader}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := TokenFromAuthHeader(r.Header.Get("Authorization"))
+			if err == nil {
+				var tokeninfo *TokenInfo
+				if tokeninfo, err = VerifyWithOptions(r.Context(), token, options); err == nil {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenInfoKey{}, tokeninfo)))
+					return
+				}
+			}
+			// The token may well be valid, so the client should retry rather than re-authenticate
+			if IsFetchError(err) {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		})
+	}
+}
+
+// FromContext returns the TokenInfo Middleware stored in ctx, if any
+func FromContext(ctx context.Context) (*TokenInfo, bool) {
+	tokeninfo, ok := ctx.Value(tokenInfoKey{}).(*TokenInfo)
+	return tokeninfo, ok
+}
@@ -0,0 +1,111 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	expiredClaims := testClaims()
+	expiredClaims["exp"] = time.Now().Add(-time.Hour).Unix()
+	provider := &stubKeyProvider{certs: testCerts(t)}
+	handler := Middleware(testAud, func(opts *VerifyOptions) { opts.KeyProvider = provider })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokeninfo, ok := FromContext(r.Context())
+		if !ok {
+			t.Errorf("got no TokenInfo\nwant one in the request context")
+			return
+		}
+		w.Write([]byte(tokeninfo.Sub))
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		expected int
+		body     string
+	}{
+		{"valid", "Bearer " + signTestToken(t, nil, testClaims()), http.StatusOK, "110169484474386276334"},
+		{"missing", "", http.StatusUnauthorized, "Unauthorized\n"},
+		{"wrong scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Unauthorized\n"},
+		{"expired", "Bearer " + signTestToken(t, nil, expiredClaims), http.StatusUnauthorized, "Unauthorized\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.expected {
+				t.Errorf("got %v\nwant %v", w.Code, tt.expected)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("got %q\nwant %q", w.Body.String(), tt.body)
+			}
+			if tt.expected == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("got %q\nwant %q", w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestMiddlewareCertsUnavailable(t *testing.T) {
+	provider := &stubKeyProvider{err: newFetchError(errors.New("connection refused"))}
+	handler := Middleware(testAud, func(opts *VerifyOptions) { opts.KeyProvider = provider })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got a call to next\nwant none without certs")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestToken(t, nil, testClaims()))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %v\nwant %v", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("got %q\nwant no challenge", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestMiddlewareCachesCerts(t *testing.T) {
+	bt, err := json.Marshal(testCerts(t))
+	if err != nil {
+		t.Fatalf("marshal certs: %v", err)
+	}
+	var fetches int
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		fetches++
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "public, max-age=3600")
+		rec.Write(bt)
+		return rec.Result(), nil
+	})}
+	handler := Middleware(testAud, func(opts *VerifyOptions) {
+		opts.HTTPClient = client
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+signTestToken(t, nil, testClaims()))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %v\nwant %v", w.Code, http.StatusOK)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestFromContextEmpty(t *testing.T) {
+	if tokeninfo, ok := FromContext(context.Background()); ok || tokeninfo != nil {
+		t.Errorf("got %v, %v\nwant nil, false", tokeninfo, ok)
+	}
+}
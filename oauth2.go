@@ -0,0 +1,33 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+var ErrorOAuth2TokenMissingIDToken error = errors.New("OAuth2 token has no id_token, request the openid scope")
+
+// OAuth2Token is the part of *oauth2.Token from golang.org/x/oauth2 that VerifyOAuth2Token uses,
+// so that this package needn't depend on x/oauth2
+type OAuth2Token interface {
+	Extra(key string) interface{}
+}
+
+// VerifyOAuth2Token verifies the ID token returned alongside an access token, such as by (*oauth2.Config).Exchange,
+// with the checks of VerifyIDTokenForClient for the Client ID aud
+func VerifyOAuth2Token(ctx context.Context, tok OAuth2Token, aud string) (*TokenInfo, error) {
+	return verifyOAuth2Token(ctx, tok, aud, defaultCertCache)
+}
+
+func verifyOAuth2Token(ctx context.Context, tok OAuth2Token, aud string, provider KeyProvider) (*TokenInfo, error) {
+	// A nil *oauth2.Token in the interface isn't == nil, and its Extra would dereference it
+	if v := reflect.ValueOf(tok); tok == nil || v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, ErrorOAuth2TokenMissingIDToken
+	}
+	idToken, ok := tok.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return nil, ErrorOAuth2TokenMissingIDToken
+	}
+	return verifyIDTokenForClient(ctx, idToken, aud, provider)
+}
@@ -0,0 +1,55 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubOAuth2Token mimics an *oauth2.Token from golang.org/x/oauth2, whose Extra reads the raw token response
+type stubOAuth2Token map[string]interface{}
+
+func (tok stubOAuth2Token) Extra(key string) interface{} {
+	return tok[key]
+}
+
+// stubOAuth2TokenPtr mimics *oauth2.Token more closely: its Extra panics on a nil pointer
+type stubOAuth2TokenPtr struct {
+	raw map[string]interface{}
+}
+
+func (tok *stubOAuth2TokenPtr) Extra(key string) interface{} {
+	return tok.raw[key]
+}
+
+func TestVerifyOAuth2Token(t *testing.T) {
+	provider := &StaticKeyProvider{Certs: testCerts(t)}
+	idToken := signTestToken(t, nil, testClaims())
+	tests := []struct {
+		name     string
+		tok      OAuth2Token
+		aud      string
+		expected error
+	}{
+		{"id token", stubOAuth2Token{"access_token": "ya29.a0", "id_token": idToken}, testAud, nil},
+		{"other client", stubOAuth2Token{"access_token": "ya29.a0", "id_token": idToken}, "other", ErrorTokenInvalidAudience},
+		{"no id token", stubOAuth2Token{"access_token": "ya29.a0"}, testAud, ErrorOAuth2TokenMissingIDToken},
+		{"empty id token", stubOAuth2Token{"id_token": ""}, testAud, ErrorOAuth2TokenMissingIDToken},
+		{"non-string id token", stubOAuth2Token{"id_token": 42}, testAud, ErrorOAuth2TokenMissingIDToken},
+		{"nil token", nil, testAud, ErrorOAuth2TokenMissingIDToken},
+		{"typed nil token", (*stubOAuth2TokenPtr)(nil), testAud, ErrorOAuth2TokenMissingIDToken},
+		{"pointer token", &stubOAuth2TokenPtr{raw: map[string]interface{}{"id_token": idToken}}, testAud, nil},
+		{"malformed id token", stubOAuth2Token{"id_token": "XXX"}, testAud, ErrorTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := verifyOAuth2Token(context.Background(), tt.tok, tt.aud, provider)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Sub != "110169484474386276334" {
+				t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+			}
+		})
+	}
+}
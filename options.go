@@ -0,0 +1,161 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultMaxTokenSize bounds the size of a token, before it is decoded. Google ID tokens are around 1KB
+const defaultMaxTokenSize = 8 << 10
+
+// certsFetchTimeout bounds each cert fetch by the client made for VerifyOptions.Transport
+const certsFetchTimeout = 10 * time.Second
+
+// googleIssuers are the issuers Google signs ID tokens as
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// VerifyOptions adjusts how a token is verified. The zero value applies the default checks
+type VerifyOptions struct {
+	// Audiences lists the Client IDs the token may be issued to
+	Audiences []string
+	// ExpectedIssuers lists the accepted issuers, for verifying tokens from other OIDC providers
+	// such as a Firebase project or a custom identity server. Google's issuers are used if empty
+	ExpectedIssuers []string
+	// SkipIssuerCheck accepts tokens from any issuer, ignoring ExpectedIssuers. It weakens verification:
+	// a token signed by any key in the certs passes, whoever claims to have issued it.
+	// Only set it against a mock issuer in tests, or briefly while migrating between providers
+	SkipIssuerCheck bool
+	// Leeway is the clock skew tolerated when checking nbf, iat and exp
+	Leeway time.Duration
+	// MaxTokenSize is the longest token accepted, in bytes. 8KB is used if zero
+	MaxTokenSize int
+	// Now returns the time tokens are checked against. time.Now is used if nil
+	Now func() time.Time
+	// AsOf, if set, is the time tokens are checked against in place of Now,
+	// for checking whether an archived token was valid when it was used
+	AsOf time.Time
+	// ExpectedAzp, if set, must equal the token's authorized party
+	ExpectedAzp string
+	// ExpectedHostedDomain, if set, must equal the token's Google Workspace domain
+	ExpectedHostedDomain string
+	// ExpectedNonce, if set, must equal the nonce the client sent in the authentication request
+	ExpectedNonce string
+	// RequireSubject rejects tokens whose sub, the stable user identifier, is missing or empty
+	RequireSubject bool
+	// AllowedEmailDomains, if set, lists the domains the token's email may belong to, compared case-insensitively
+	AllowedEmailDomains []string
+	// RequireEmailVerified rejects tokens whose email_verified is false or missing.
+	// Set it if the email is used to identify the user, since without it the address may not belong to them
+	RequireEmailVerified bool
+	// RequireJWTType rejects tokens whose header has a typ other than JWT
+	RequireJWTType bool
+	// AllowedKeyThumbprints, if set, pins the keys tokens may be signed with by their RFC 7638 SHA-256 thumbprints,
+	// as returned by (*Key).Thumbprint. A token signed by any other key is rejected, even one in Google's certs
+	AllowedKeyThumbprints [][]byte
+	// KeyProvider supplies the certs. If nil, they are fetched from Google using HTTPClient and Retry
+	KeyProvider KeyProvider
+	// HTTPClient is used to fetch the certs. If nil, a client using Transport is, or else http.DefaultClient
+	HTTPClient *http.Client
+	// Transport, if set and HTTPClient isn't, carries the cert fetches, such as to trace them,
+	// through a client with this package's own timeout
+	Transport http.RoundTripper
+	// Retry controls how failed cert fetches are retried
+	Retry RetryPolicy
+	// CertsHeader holds extra headers to send when fetching the certs, such as an API key a proxy requires
+	CertsHeader http.Header
+	// OnResult, if set, is called once per verification with an Outcome label and the error, if any,
+	// so that results can be counted without this package depending on a metrics library
+	OnResult func(outcome string, err error)
+}
+
+func (opts VerifyOptions) issuers() []string {
+	if len(opts.ExpectedIssuers) == 0 {
+		return googleIssuers
+	}
+	return opts.ExpectedIssuers
+}
+
+func (opts VerifyOptions) maxTokenSize() int {
+	if opts.MaxTokenSize == 0 {
+		return defaultMaxTokenSize
+	}
+	return opts.MaxTokenSize
+}
+
+func (opts VerifyOptions) now() time.Time {
+	if !opts.AsOf.IsZero() {
+		return opts.AsOf
+	}
+	if opts.Now == nil {
+		return time.Now()
+	}
+	return opts.Now()
+}
+
+func (opts VerifyOptions) report(err error) {
+	if opts.OnResult != nil {
+		opts.OnResult(outcome(err), err)
+	}
+}
+
+func (opts VerifyOptions) keyProvider() KeyProvider {
+	if opts.KeyProvider == nil {
+		return &HTTPKeyProvider{Client: opts.httpClient(), Retry: opts.Retry, Header: opts.CertsHeader}
+	}
+	return opts.KeyProvider
+}
+
+func (opts VerifyOptions) httpClient() *http.Client {
+	if opts.HTTPClient == nil && opts.Transport != nil {
+		return &http.Client{Transport: opts.Transport, Timeout: certsFetchTimeout}
+	}
+	return opts.HTTPClient
+}
+
+// VerifyWithOptions gets the certs from opts.KeyProvider and verifies authToken against them, with the checks described by opts.
+// If the token's kid is unknown and the provider caches certs, such as CertCache, the certs are refetched once
+// in case Google has rotated in a new key
+func VerifyWithOptions(ctx context.Context, authToken string, opts VerifyOptions) (tokeninfo *TokenInfo, err error) {
+	defer func() { opts.report(err) }()
+	tokeninfo, _, err = verifyWithProvider(ctx, authToken, opts)
+	return tokeninfo, err
+}
+
+// verifyWithProvider is VerifyWithOptions without the report to opts.OnResult, also returning the decoded payload
+func verifyWithProvider(ctx context.Context, authToken string, opts VerifyOptions) (*TokenInfo, []byte, error) {
+	provider := opts.keyProvider()
+	certs, err := provider.GetCerts(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokeninfo, payload, err := verifyGoogleIDTokenPayload(authToken, certs, opts)
+	if refresher, ok := provider.(keyRefresher); ok && errors.Is(err, ErrorTokenInvalidKey) {
+		if certs, err = refresher.refresh(ctx); err != nil {
+			return nil, nil, err
+		}
+		return verifyGoogleIDTokenPayload(authToken, certs, opts)
+	}
+	return tokeninfo, payload, err
+}
+
+// VerifyIDTokenForClient verifies a Google ID token issued to the OAuth client clientID, applying the checks
+// Google recommends: the signature, an aud of clientID, a Google iss, an exp in the future and a non-empty sub.
+// A typ other than JWT is rejected. The certs are shared with Verify and cached until they expire
+func VerifyIDTokenForClient(ctx context.Context, authToken string, clientID string) (*TokenInfo, error) {
+	return verifyIDTokenForClient(ctx, authToken, clientID, defaultCertCache)
+}
+
+func verifyIDTokenForClient(ctx context.Context, authToken string, clientID string, provider KeyProvider) (*TokenInfo, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("%w: client ID is empty", ErrorTokenInvalidAudience)
+	}
+	return VerifyWithOptions(ctx, authToken, VerifyOptions{
+		Audiences:      []string{clientID},
+		RequireSubject: true,
+		RequireJWTType: true,
+		KeyProvider:    provider,
+	})
+}
@@ -0,0 +1,296 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// testCertsClient returns a client that answers every request with certs
+func testCertsClient(t testing.TB, certs *Certs) *http.Client {
+	bt, err := json.Marshal(certs)
+	if err != nil {
+		t.Fatalf("marshal certs: %v", err)
+	}
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		rec.Write(bt)
+		return rec.Result(), nil
+	})}
+}
+
+func TestVerifyWithOptions(t *testing.T) {
+	client := testCertsClient(t, testCerts(t))
+	tests := []struct {
+		name     string
+		claims   func(map[string]interface{})
+		opts     VerifyOptions
+		expected error
+	}{
+		{"defaults", nil, VerifyOptions{Audiences: []string{testAud}}, nil},
+		{"audiences", nil, VerifyOptions{Audiences: []string{"other"}}, ErrorTokenInvalidAudience},
+		{"default issuers", func(c map[string]interface{}) { c["iss"] = "accounts.google.com" }, VerifyOptions{Audiences: []string{testAud}}, nil},
+		{"default issuers reject others", func(c map[string]interface{}) { c["iss"] = "https://example.com" }, VerifyOptions{Audiences: []string{testAud}}, ErrorTokenInvalidISS},
+		{"expected issuers", func(c map[string]interface{}) { c["iss"] = "https://example.com" }, VerifyOptions{Audiences: []string{testAud}, ExpectedIssuers: []string{"https://example.com"}}, nil},
+		{"skip issuer check", func(c map[string]interface{}) { c["iss"] = "https://mock-issuer.test" }, VerifyOptions{Audiences: []string{testAud}, SkipIssuerCheck: true}, nil},
+		{"skip issuer check ignores expected issuers", func(c map[string]interface{}) { c["iss"] = "https://mock-issuer.test" }, VerifyOptions{Audiences: []string{testAud}, ExpectedIssuers: []string{"https://example.com"}, SkipIssuerCheck: true}, nil},
+		{"issuer checked by default", func(c map[string]interface{}) { c["iss"] = "https://mock-issuer.test" }, VerifyOptions{Audiences: []string{testAud}, ExpectedIssuers: []string{"https://example.com"}}, ErrorTokenInvalidISS},
+		{"leeway", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }, VerifyOptions{Audiences: []string{testAud}, Leeway: time.Minute}, nil},
+		{"azp", nil, VerifyOptions{Audiences: []string{testAud}, ExpectedAzp: "other"}, ErrorTokenInvalidAZP},
+		{"hosted domain", nil, VerifyOptions{Audiences: []string{testAud}, ExpectedHostedDomain: "example.com"}, ErrorTokenInvalidHostedDomain},
+		{"nonce", nil, VerifyOptions{Audiences: []string{testAud}, ExpectedNonce: "abc"}, ErrorTokenInvalidNonce},
+		{"subject", nil, VerifyOptions{Audiences: []string{testAud}, RequireSubject: true}, nil},
+		{"empty subject", func(c map[string]interface{}) { c["sub"] = "" }, VerifyOptions{Audiences: []string{testAud}, RequireSubject: true}, ErrorTokenMissingSubject},
+		{"absent subject", func(c map[string]interface{}) { delete(c, "sub") }, VerifyOptions{Audiences: []string{testAud}, RequireSubject: true}, ErrorTokenMissingSubject},
+		{"allowed email domain", nil, VerifyOptions{Audiences: []string{testAud}, AllowedEmailDomains: []string{"example.com", "gmail.com"}}, nil},
+		{"allowed email domain case", func(c map[string]interface{}) { c["email"] = "TestUser@GMail.COM" }, VerifyOptions{Audiences: []string{testAud}, AllowedEmailDomains: []string{"gmail.com"}}, nil},
+		{"disallowed email domain", nil, VerifyOptions{Audiences: []string{testAud}, AllowedEmailDomains: []string{"example.com"}}, ErrorTokenEmailNotAllowed},
+		{"disallowed email subdomain", func(c map[string]interface{}) { c["email"] = "testuser@mail.example.com" }, VerifyOptions{Audiences: []string{testAud}, AllowedEmailDomains: []string{"example.com"}}, ErrorTokenEmailNotAllowed},
+		{"missing email", func(c map[string]interface{}) { delete(c, "email") }, VerifyOptions{Audiences: []string{testAud}, AllowedEmailDomains: []string{"gmail.com"}}, ErrorTokenEmailNotAllowed},
+		{"verified email", func(c map[string]interface{}) { c["email_verified"] = true }, VerifyOptions{Audiences: []string{testAud}, RequireEmailVerified: true, AllowedEmailDomains: []string{"gmail.com"}}, nil},
+		{"unverified email", func(c map[string]interface{}) { c["email_verified"] = false }, VerifyOptions{Audiences: []string{testAud}, RequireEmailVerified: true, AllowedEmailDomains: []string{"gmail.com"}}, ErrorTokenEmailNotVerified},
+		{"absent subject not required", func(c map[string]interface{}) { delete(c, "sub") }, VerifyOptions{Audiences: []string{testAud}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			opts := tt.opts
+			opts.HTTPClient = client
+			_, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, claims), opts)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyOptionsNow(t *testing.T) {
+	iat := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	claims := testClaims()
+	claims["iat"] = iat.Unix()
+	claims["nbf"] = iat.Add(time.Minute).Unix()
+	claims["exp"] = iat.Add(time.Hour).Unix()
+	token := signTestToken(t, nil, claims)
+	certs := testCerts(t)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected error
+	}{
+		// nbf is checked before iat, so a time before both is reported as not yet valid
+		{"before iat", iat.Add(-time.Second), ErrorTokenNotYetValid},
+		{"before nbf", iat.Add(time.Minute - time.Second), ErrorTokenNotYetValid},
+		{"at nbf", iat.Add(time.Minute), nil},
+		{"at exp", iat.Add(time.Hour), nil},
+		{"after exp", iat.Add(time.Hour + time.Second), ErrorTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := VerifyOptions{Now: func() time.Time { return tt.now }}
+			_, err := VerifyGoogleIDTokenWithOptions(token, certs, testAud, opts)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyOptionsMaxTokenSize(t *testing.T) {
+	certs := testCerts(t)
+	token := signTestToken(t, nil, testClaims())
+	padded := func(size int) string {
+		claims := testClaims()
+		claims["pad"] = ""
+		base := len(signTestToken(t, nil, claims))
+		// Each 3 bytes of padding add 4 base64 characters to the token
+		claims["pad"] = strings.Repeat("x", (size-base)/4*3)
+		return signTestToken(t, nil, claims)
+	}
+	underDefault := padded(defaultMaxTokenSize - 4)
+
+	tests := []struct {
+		name     string
+		token    string
+		max      int
+		expected error
+	}{
+		{"default", token, 0, nil},
+		{"under default", underDefault, 0, nil},
+		{"over default", underDefault + strings.Repeat("x", defaultMaxTokenSize-len(underDefault)+1), 0, ErrorTokenTooLarge},
+		{"at custom", token, len(token), nil},
+		{"over custom", token, len(token) - 1, ErrorTokenTooLarge},
+		{"over default within custom", padded(2 * defaultMaxTokenSize), 3 * defaultMaxTokenSize, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyGoogleIDTokenWithOptions(tt.token, certs, testAud, VerifyOptions{MaxTokenSize: tt.max})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyOptionsAsOf(t *testing.T) {
+	recorded := time.Now().Add(-48 * time.Hour)
+	claims := testClaims()
+	claims["iat"] = recorded.Add(-time.Minute).Unix()
+	claims["exp"] = recorded.Add(time.Hour).Unix()
+	token := signTestToken(t, nil, claims)
+	certs := testCerts(t)
+
+	if _, err := VerifyGoogleIDToken(token, certs, testAud); !errors.Is(err, ErrorTokenExpired) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenExpired)
+	}
+	tests := []struct {
+		name     string
+		opts     VerifyOptions
+		expected error
+	}{
+		{"as of recording", VerifyOptions{AsOf: recorded}, nil},
+		{"as of recording ignores Now", VerifyOptions{AsOf: recorded, Now: time.Now}, nil},
+		{"as of before issue", VerifyOptions{AsOf: recorded.Add(-time.Hour)}, ErrorTokenUsedBeforeIssued},
+		{"as of after expiry", VerifyOptions{AsOf: recorded.Add(2 * time.Hour)}, ErrorTokenExpired},
+		{"as of after expiry within leeway", VerifyOptions{AsOf: recorded.Add(time.Hour + time.Minute), Leeway: 2 * time.Minute}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyGoogleIDTokenWithOptions(token, certs, testAud, tt.opts)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenForClient(t *testing.T) {
+	authToken, certs, err := GenerateTestToken(testSigningKey(t), testKeyID, TokenInfo{
+		Iss: "https://accounts.google.com",
+		Aud: Audience{testAud},
+		Sub: "110169484474386276334",
+	})
+	if err != nil {
+		t.Fatalf("GenerateTestToken: %v", err)
+	}
+	document, err := json.Marshal(certs)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(document)
+	}))
+	defer ts.Close()
+	cache := &CertCache{Client: ts.Client(), URL: ts.URL}
+
+	expired, _, err := GenerateTestToken(testSigningKey(t), testKeyID, TokenInfo{
+		Iss: "https://accounts.google.com",
+		Aud: Audience{testAud},
+		Sub: "110169484474386276334",
+		Iat: NumericDate(time.Now().Add(-2 * time.Hour).Unix()),
+	})
+	if err != nil {
+		t.Fatalf("GenerateTestToken: %v", err)
+	}
+	wrongIssuer := testClaims()
+	wrongIssuer["iss"] = "https://example.com"
+	noSubject := testClaims()
+	delete(noSubject, "sub")
+
+	tests := []struct {
+		name      string
+		authToken string
+		clientID  string
+		expected  error
+	}{
+		{"valid", authToken, testAud, nil},
+		{"other client", authToken, "other.apps.googleusercontent.com", ErrorTokenInvalidAudience},
+		{"empty client ID", authToken, "", ErrorTokenInvalidAudience},
+		{"expired", expired, testAud, ErrorTokenExpired},
+		{"wrong issuer", signTestToken(t, nil, wrongIssuer), testAud, ErrorTokenInvalidISS},
+		{"missing subject", signTestToken(t, nil, noSubject), testAud, ErrorTokenMissingSubject},
+		{"wrong type", signTestToken(t, map[string]interface{}{"alg": "RS256", "kid": testKeyID, "typ": "at+jwt"}, testClaims()), testAud, ErrorTokenInvalidType},
+		{"tampered", authToken[:len(authToken)-4] + "AAAA", testAud, ErrorTokenSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := verifyIDTokenForClient(context.Background(), tt.authToken, tt.clientID, cache)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Sub != "110169484474386276334" {
+				t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+			}
+		})
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+// recordingTransport records the URL of each request before passing it to next
+type recordingTransport struct {
+	next      http.RoundTripper
+	mu        sync.Mutex
+	requested []string
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.requested = append(rt.requested, r.URL.String())
+	rt.mu.Unlock()
+	return rt.next.RoundTrip(r)
+}
+
+func TestVerifyOptionsTransport(t *testing.T) {
+	var failures int32
+	flaky := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&failures, 1) == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return testCertsClient(t, testCerts(t)).Transport.RoundTrip(r)
+	})
+	transport := &recordingTransport{next: flaky}
+	opts := VerifyOptions{Audiences: []string{testAud}, Transport: transport, Retry: RetryPolicy{Backoff: time.Millisecond}}
+	if _, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	// The first attempt fails, so the retry policy applies to the transport too
+	if expected := []string{googleCertsURL, googleCertsURL}; !reflect.DeepEqual(transport.requested, expected) {
+		t.Errorf("got %v\nwant %v", transport.requested, expected)
+	}
+	if client := opts.httpClient(); client.Transport != transport || client.Timeout != certsFetchTimeout {
+		t.Errorf("got transport %v, timeout %v\nwant %v, %v", client.Transport, client.Timeout, transport, certsFetchTimeout)
+	}
+
+	// A full client takes precedence over Transport
+	opts.HTTPClient = testCertsClient(t, testCerts(t))
+	transport.requested = nil
+	if _, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts); err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if len(transport.requested) != 0 {
+		t.Errorf("got %v\nwant no requests through Transport", transport.requested)
+	}
+}
@@ -0,0 +1,85 @@
+package GoogleIdTokenVerifier
+
+import "errors"
+
+// Outcome labels passed to VerifyOptions.OnResult
+const (
+	OutcomeOK                   = "ok"
+	OutcomeExpired              = "expired"
+	OutcomeUsedBeforeIssued     = "used_before_issued"
+	OutcomeNotYetValid          = "not_yet_valid"
+	OutcomeMissingAudience      = "missing_audience"
+	OutcomeInvalidAudience      = "invalid_audience"
+	OutcomeInvalidIssuer        = "invalid_issuer"
+	OutcomeInvalidAzp           = "invalid_azp"
+	OutcomeInvalidHostedDomain  = "invalid_hosted_domain"
+	OutcomeInvalidNonce         = "invalid_nonce"
+	OutcomeInvalidAtHash        = "invalid_at_hash"
+	OutcomeMissingSubject       = "missing_subject"
+	OutcomeEmailNotVerified     = "email_not_verified"
+	OutcomeEmailNotAllowed      = "email_not_allowed"
+	OutcomeInvalidType          = "invalid_type"
+	OutcomeUnsupportedAlgorithm = "unsupported_algorithm"
+	OutcomeAlgorithmMismatch    = "algorithm_mismatch"
+	OutcomeUnknownKey           = "unknown_key"
+	OutcomeInvalidSignature     = "invalid_signature"
+	OutcomeMalformed            = "malformed"
+	OutcomeCertsUnavailable     = "certs_unavailable"
+	OutcomeError                = "error"
+)
+
+// outcomes maps each error to its label, checked in order with errors.Is. It covers every error in
+// tokenErrors and fetchErrors, and like IsTokenError puts a fetch error ahead of any token error it wraps
+var outcomes = []struct {
+	err   error
+	label string
+}{
+	{ErrorCertsFetchFailed, OutcomeCertsUnavailable},
+	{ErrorCertsFetchInvalid, OutcomeCertsUnavailable},
+	{ErrorCertsMalformed, OutcomeCertsUnavailable},
+	{ErrorCertsDuplicateKeyID, OutcomeCertsUnavailable},
+	{ErrorWeakSigningKey, OutcomeCertsUnavailable},
+	{ErrorCertsInvalidPEM, OutcomeCertsUnavailable},
+	{ErrorCertsMissingKeyID, OutcomeCertsUnavailable},
+	{ErrorTokenExpired, OutcomeExpired},
+	{ErrorTokenUsedBeforeIssued, OutcomeUsedBeforeIssued},
+	{ErrorTokenNotYetValid, OutcomeNotYetValid},
+	{ErrorTokenMissingAudience, OutcomeMissingAudience},
+	{ErrorTokenInvalidAudience, OutcomeInvalidAudience},
+	{ErrorTokenInvalidISS, OutcomeInvalidIssuer},
+	{ErrorTokenInvalidAZP, OutcomeInvalidAzp},
+	{ErrorTokenInvalidHostedDomain, OutcomeInvalidHostedDomain},
+	{ErrorTokenInvalidNonce, OutcomeInvalidNonce},
+	{ErrorTokenInvalidAtHash, OutcomeInvalidAtHash},
+	{ErrorTokenMissingSubject, OutcomeMissingSubject},
+	{ErrorTokenEmailNotVerified, OutcomeEmailNotVerified},
+	{ErrorTokenEmailNotAllowed, OutcomeEmailNotAllowed},
+	{ErrorTokenInvalidType, OutcomeInvalidType},
+	{ErrorTokenUnsupportedAlgorithm, OutcomeUnsupportedAlgorithm},
+	{ErrorTokenAlgorithmMismatch, OutcomeAlgorithmMismatch},
+	{ErrorTokenMissingKeyID, OutcomeUnknownKey},
+	{ErrorTokenInvalidKey, OutcomeUnknownKey},
+	{ErrorTokenKeyNotAllowed, OutcomeUnknownKey},
+	{ErrorTokenSignatureInvalid, OutcomeInvalidSignature},
+	{ErrorTokenMalformedSignature, OutcomeInvalidSignature},
+	{ErrorTokenTooLarge, OutcomeMalformed},
+	{ErrorTokenMalformed, OutcomeMalformed},
+	{ErrorTokenMalformedHeader, OutcomeMalformed},
+	{ErrorTokenMalformedPayload, OutcomeMalformed},
+	{ErrorOAuth2TokenMissingIDToken, OutcomeMalformed},
+	{ErrorAuthHeaderMissing, OutcomeMalformed},
+	{ErrorAuthHeaderMalformed, OutcomeMalformed},
+}
+
+// outcome returns the OnResult label for the result of a verification
+func outcome(err error) string {
+	if err == nil {
+		return OutcomeOK
+	}
+	for _, o := range outcomes {
+		if errors.Is(err, o.err) {
+			return o.label
+		}
+	}
+	return OutcomeError
+}
@@ -0,0 +1,118 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyOnResult(t *testing.T) {
+	certs := testCerts(t)
+	valid := strings.Split(signTestToken(t, nil, testClaims()), ".")
+	other := strings.Split(signTestToken(t, nil, map[string]interface{}{"sub": "other"}), ".")
+	forged := valid[0] + "." + valid[1] + "." + other[2]
+	tests := []struct {
+		name     string
+		header   map[string]interface{}
+		claims   func(map[string]interface{})
+		token    string
+		opts     VerifyOptions
+		expected string
+	}{
+		{name: "ok", expected: OutcomeOK},
+		{name: "expired", claims: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, expected: OutcomeExpired},
+		{name: "used before issued", claims: func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }, expected: OutcomeUsedBeforeIssued},
+		{name: "not yet valid", claims: func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, expected: OutcomeNotYetValid},
+		{name: "audience", claims: func(c map[string]interface{}) { c["aud"] = "other" }, expected: OutcomeInvalidAudience},
+		{name: "missing audience", claims: func(c map[string]interface{}) { delete(c, "aud") }, expected: OutcomeMissingAudience},
+		{name: "issuer", claims: func(c map[string]interface{}) { c["iss"] = "https://example.com" }, expected: OutcomeInvalidIssuer},
+		{name: "azp", opts: VerifyOptions{ExpectedAzp: "other"}, expected: OutcomeInvalidAzp},
+		{name: "hosted domain", opts: VerifyOptions{ExpectedHostedDomain: "example.com"}, expected: OutcomeInvalidHostedDomain},
+		{name: "nonce", opts: VerifyOptions{ExpectedNonce: "abc"}, expected: OutcomeInvalidNonce},
+		{name: "type", header: map[string]interface{}{"alg": "RS256", "kid": testKeyID, "typ": "at+jwt"}, opts: VerifyOptions{RequireJWTType: true}, expected: OutcomeInvalidType},
+		{name: "algorithm", header: map[string]interface{}{"alg": "HS256", "kid": testKeyID}, expected: OutcomeUnsupportedAlgorithm},
+		{name: "missing kid", header: map[string]interface{}{"alg": "RS256"}, expected: OutcomeUnknownKey},
+		{name: "unknown kid", header: map[string]interface{}{"alg": "RS256", "kid": "unknown"}, expected: OutcomeUnknownKey},
+		{name: "unpinned key", opts: VerifyOptions{AllowedKeyThumbprints: [][]byte{make([]byte, 32)}}, expected: OutcomeUnknownKey},
+		{name: "signature", token: forged, expected: OutcomeInvalidSignature},
+		{name: "malformed", token: "XXX", expected: OutcomeMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				claims := testClaims()
+				if tt.claims != nil {
+					tt.claims(claims)
+				}
+				token = signTestToken(t, tt.header, claims)
+			}
+			var calls int
+			var actual string
+			opts := tt.opts
+			opts.OnResult = func(outcome string, err error) {
+				calls++
+				actual = outcome
+			}
+			VerifyGoogleIDTokenWithOptions(token, certs, testAud, opts)
+			if calls != 1 {
+				t.Fatalf("got %d calls\nwant 1", calls)
+			}
+			if actual != tt.expected {
+				t.Errorf("got %v\nwant %v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyWithOptionsOnResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider KeyProvider
+		expected string
+	}{
+		{"ok", &stubKeyProvider{certs: testCerts(t)}, OutcomeOK},
+		{"fetch failed", &stubKeyProvider{err: newFetchError(errors.New("connection refused"))}, OutcomeCertsUnavailable},
+		{"other error", &stubKeyProvider{err: errors.New("boom")}, OutcomeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual []string
+			opts := VerifyOptions{
+				Audiences:   []string{testAud},
+				KeyProvider: tt.provider,
+				OnResult:    func(outcome string, err error) { actual = append(actual, outcome) },
+			}
+			VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts)
+			if len(actual) != 1 || actual[0] != tt.expected {
+				t.Errorf("got %v\nwant [%v]", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	if actual := outcome(newAlgorithmError("RS256")); actual != OutcomeUnsupportedAlgorithm {
+		t.Errorf("got %v\nwant %v", actual, OutcomeUnsupportedAlgorithm)
+	}
+	for _, err := range []error{ErrorTokenSignatureInvalid, ErrorTokenMalformedSignature} {
+		if actual := outcome(err); actual != OutcomeInvalidSignature {
+			t.Errorf("got %v\nwant %v", actual, OutcomeInvalidSignature)
+		}
+	}
+}
+
+func TestOutcomesMatchErrorClasses(t *testing.T) {
+	for _, err := range tokenErrors {
+		if actual := outcome(err); actual == OutcomeError || actual == OutcomeCertsUnavailable {
+			t.Errorf("%v: got %v\nwant a token outcome", err, actual)
+		}
+	}
+	for _, err := range fetchErrors {
+		if actual := outcome(err); actual != OutcomeCertsUnavailable {
+			t.Errorf("%v: got %v\nwant %v", err, actual, OutcomeCertsUnavailable)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"net/http"
+)
+
+// KeyProvider supplies the certs tokens are verified against. Implement it
+// to source keys from a custom cache, such as Redis or a shared file
+type KeyProvider interface {
+	GetCerts(ctx context.Context) (*Certs, error)
+}
+
+// keyRefresher is implemented by caching providers that can be told their certs may be out of date
+type keyRefresher interface {
+	refresh(ctx context.Context) (*Certs, error)
+}
+
+// HTTPKeyProvider fetches the certs from the network on every call
+type HTTPKeyProvider struct {
+	// Client is used for the fetch. http.DefaultClient is used if nil
+	Client *http.Client
+	// URL is the JWKS endpoint to fetch from. Google's endpoint is used if empty
+	URL string
+	// Retry controls how failed fetches are retried
+	Retry RetryPolicy
+	// Header holds extra headers to send with each fetch, such as an API key a proxy in front of the endpoint requires
+	Header http.Header
+}
+
+// GetCerts fetches and parses the certs
+func (p *HTTPKeyProvider) GetCerts(ctx context.Context) (*Certs, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := p.URL
+	if url == "" {
+		url = googleCertsURL
+	}
+	res, err := fetchCerts(ctx, client, url, p.Header, p.Retry, true)
+	if err != nil {
+		return nil, err
+	}
+	return res.certs, nil
+}
+
+// StaticKeyProvider supplies fixed certs, such as a key set pinned in configuration
+type StaticKeyProvider struct {
+	Certs *Certs
+}
+
+// GetCerts returns p.Certs
+func (p *StaticKeyProvider) GetCerts(ctx context.Context) (*Certs, error) {
+	return p.Certs, nil
+}
+
+// FallbackKeyProvider prefers the certs from Primary, such as a pinned key set, and consults Fallback,
+// such as a CertCache, only when a token names a kid Primary doesn't have
+type FallbackKeyProvider struct {
+	Primary  KeyProvider
+	Fallback KeyProvider
+}
+
+// GetCerts returns the certs from p.Primary
+func (p *FallbackKeyProvider) GetCerts(ctx context.Context) (*Certs, error) {
+	return p.Primary.GetCerts(ctx)
+}
+
+// refresh returns the certs from p.Fallback, once a token's kid is missing from p.Primary
+func (p *FallbackKeyProvider) refresh(ctx context.Context) (*Certs, error) {
+	return p.Fallback.GetCerts(ctx)
+}
@@ -0,0 +1,135 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// stubKeyProvider returns fixed certs and counts how often it is asked
+type stubKeyProvider struct {
+	certs *Certs
+	err   error
+	calls int32
+}
+
+func (p *stubKeyProvider) GetCerts(ctx context.Context) (*Certs, error) {
+	atomic.AddInt32(&p.calls, 1)
+	return p.certs, p.err
+}
+
+func TestVerifyWithOptionsKeyProvider(t *testing.T) {
+	provider := &stubKeyProvider{certs: testCerts(t)}
+	opts := VerifyOptions{Audiences: []string{testAud}, KeyProvider: provider}
+	actual, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+	if provider.calls != 1 {
+		t.Errorf("got %d calls\nwant 1", provider.calls)
+	}
+}
+
+func TestVerifyWithOptionsKeyProviderError(t *testing.T) {
+	unavailable := errors.New("redis: connection refused")
+	opts := VerifyOptions{Audiences: []string{testAud}, KeyProvider: &stubKeyProvider{err: unavailable}}
+	actual, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts)
+	if !errors.Is(err, unavailable) {
+		t.Errorf("got %v\nwant %v", err, unavailable)
+	}
+	if actual != nil {
+		t.Errorf("got %v\nwant nil", actual)
+	}
+}
+
+func TestCertCacheKeyProvider(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=3600", &fetches)
+	defer ts.Close()
+
+	var provider KeyProvider = &CertCache{Client: ts.Client(), URL: ts.URL}
+	for i := 0; i < 2; i++ {
+		certs, err := provider.GetCerts(context.Background())
+		if err != nil {
+			t.Fatalf("got %v\nwant nil", err)
+		}
+		if len(certs.Keys) != 2 {
+			t.Errorf("got %d keys\nwant 2", len(certs.Keys))
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestHTTPKeyProvider(t *testing.T) {
+	var fetches int32
+	ts := newCertsServer("public, max-age=3600", &fetches)
+	defer ts.Close()
+
+	var provider KeyProvider = &HTTPKeyProvider{Client: ts.Client(), URL: ts.URL}
+	certs, err := provider.GetCerts(context.Background())
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if len(certs.Keys) != 2 {
+		t.Errorf("got %d keys\nwant 2", len(certs.Keys))
+	}
+
+	_, err = (&HTTPKeyProvider{Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("dial tcp: no route to host")
+	})}, Retry: RetryPolicy{MaxAttempts: 1}}).GetCerts(context.Background())
+	if !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+}
+
+func TestFallbackKeyProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		pinned    *Certs
+		fallbacks int32
+	}{
+		{"pinned kid", testCerts(t), 0},
+		{"unpinned kid", mustGetCerts(t, googleCertsJSON), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallback := &stubKeyProvider{certs: testCerts(t)}
+			opts := VerifyOptions{
+				Audiences:   []string{testAud},
+				KeyProvider: &FallbackKeyProvider{Primary: &StaticKeyProvider{Certs: tt.pinned}, Fallback: fallback},
+			}
+			actual, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts)
+			if err != nil {
+				t.Fatalf("got %v\nwant nil", err)
+			}
+			if actual.Sub != "110169484474386276334" {
+				t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+			}
+			if fallback.calls != tt.fallbacks {
+				t.Errorf("got %d fallback calls\nwant %d", fallback.calls, tt.fallbacks)
+			}
+		})
+	}
+}
+
+func TestFallbackKeyProviderUnknownKid(t *testing.T) {
+	fallback := &stubKeyProvider{certs: mustGetCerts(t, googleCertsJSON)}
+	opts := VerifyOptions{
+		Audiences:   []string{testAud},
+		KeyProvider: &FallbackKeyProvider{Primary: &StaticKeyProvider{Certs: mustGetCerts(t, googleCertsJSON)}, Fallback: fallback},
+	}
+	_, err := VerifyWithOptions(context.Background(), signTestToken(t, nil, testClaims()), opts)
+	if !errors.Is(err, ErrorTokenInvalidKey) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+	}
+	if fallback.calls != 1 {
+		t.Errorf("got %d fallback calls\nwant 1", fallback.calls)
+	}
+}
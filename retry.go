@@ -0,0 +1,58 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how a failed cert fetch is retried. The zero value
+// tries up to 3 times, waiting 100ms and then 200ms between attempts
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts. Set to 1 to disable retries
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubled before each one after it
+	Backoff time.Duration
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) backoff() time.Duration {
+	if p.Backoff <= 0 {
+		return 100 * time.Millisecond
+	}
+	return p.Backoff
+}
+
+// errPermanent marks a fetch failure that retrying can't fix
+type errPermanent struct{ error }
+
+func (e errPermanent) Unwrap() error { return e.error }
+
+// do calls fn until it succeeds, fails permanently, runs out of attempts or ctx is done
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	wait := p.backoff()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var permanent errPermanent
+		if errors.As(err, &permanent) {
+			return permanent.error
+		}
+		if err == nil || ctx.Err() != nil || attempt >= p.attempts() {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return newFetchError(ctx.Err())
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
@@ -0,0 +1,101 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer fails the first failures requests with status, then serves the certs
+func newFlakyServer(failures int32, status int, fetches *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(fetches, 1) <= failures {
+			http.Error(w, "try again", status)
+			return
+		}
+		w.Write([]byte(googleCertsJSON))
+	}))
+}
+
+func TestFetchCertsRetry(t *testing.T) {
+	var fetches int32
+	ts := newFlakyServer(2, http.StatusServiceUnavailable, &fetches)
+	defer ts.Close()
+
+	actual, err := fetchCerts(context.Background(), ts.Client(), ts.URL, nil, RetryPolicy{Backoff: time.Millisecond}, false)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if string(actual.body) != googleCertsJSON {
+		t.Errorf("got %q\nwant %q", actual.body, googleCertsJSON)
+	}
+	if fetches != 3 {
+		t.Errorf("got %d fetches\nwant 3", fetches)
+	}
+}
+
+func TestFetchCertsRetryExhausted(t *testing.T) {
+	var fetches int32
+	ts := newFlakyServer(3, http.StatusInternalServerError, &fetches)
+	defer ts.Close()
+
+	_, err := fetchCerts(context.Background(), ts.Client(), ts.URL, nil, RetryPolicy{Backoff: time.Millisecond}, false)
+	if !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+	if fetches != 3 {
+		t.Errorf("got %d fetches\nwant 3", fetches)
+	}
+}
+
+func TestFetchCertsNoRetryOnClientError(t *testing.T) {
+	var fetches int32
+	ts := newFlakyServer(1, http.StatusNotFound, &fetches)
+	defer ts.Close()
+
+	_, err := fetchCerts(context.Background(), ts.Client(), ts.URL, nil, RetryPolicy{Backoff: time.Millisecond}, false)
+	if !errors.Is(err, ErrorCertsFetchFailed) {
+		t.Errorf("got %v\nwant %v", err, ErrorCertsFetchFailed)
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestFetchCertsRetryCanceled(t *testing.T) {
+	var fetches int32
+	ts := newFlakyServer(3, http.StatusServiceUnavailable, &fetches)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := fetchCerts(ctx, ts.Client(), ts.URL, nil, RetryPolicy{Backoff: time.Hour}, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v\nwant %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v\nwant prompt return", elapsed)
+	}
+	if fetches != 1 {
+		t.Errorf("got %d fetches\nwant 1", fetches)
+	}
+}
+
+func TestCertCacheRetry(t *testing.T) {
+	var fetches int32
+	ts := newFlakyServer(2, http.StatusBadGateway, &fetches)
+	defer ts.Close()
+
+	cache := &CertCache{URL: ts.URL, Retry: RetryPolicy{Backoff: time.Millisecond}}
+	if _, err := cache.Get(ts.Client()); err != nil {
+		t.Errorf("got %v\nwant nil", err)
+	}
+	if fetches != 3 {
+		t.Errorf("got %d fetches\nwant 3", fetches)
+	}
+}
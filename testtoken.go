@@ -0,0 +1,56 @@
+package GoogleIdTokenVerifier
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// GenerateTestToken signs claims with priv as an RS256 token with the key ID kid, and returns it with
+// Certs holding the matching public key, so that code using this package can be tested offline.
+// Entries in claims.Claims are added to the payload unless a field of claims already sets them.
+// If claims.Iat is zero it is set to now, and if claims.Exp is zero it is set to an hour after Iat
+func GenerateTestToken(priv *rsa.PrivateKey, kid string, claims TokenInfo) (string, *Certs, error) {
+	if claims.Iat == 0 {
+		claims.Iat = NumericDate(time.Now().Unix())
+	}
+	if claims.Exp == 0 {
+		claims.Exp = claims.Iat + NumericDate(time.Hour/time.Second)
+	}
+	bt, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(bt, &payload); err != nil {
+		return "", nil, err
+	}
+	for name, value := range claims.Claims {
+		if _, ok := payload[name]; !ok {
+			payload[name] = value
+		}
+	}
+
+	header, err := json.Marshal(tokenHeader{Alg: "RS256", Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", nil, err
+	}
+	if bt, err = json.Marshal(payload); err != nil {
+		return "", nil, err
+	}
+	messageToSign := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(bt)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, calcSum(messageToSign, crypto.SHA256))
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := publicKeyToKey(&priv.PublicKey, kid)
+	if err != nil {
+		return "", nil, err
+	}
+	key.Alg = "RS256"
+	return messageToSign + "." + base64.RawURLEncoding.EncodeToString(signature), &Certs{Keys: []Key{*key}}, nil
+}
@@ -0,0 +1,60 @@
+package GoogleIdTokenVerifier
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenerateTestToken(t *testing.T) {
+	claims := TokenInfo{
+		Sub:   "110169484474386276334",
+		Email: "testuser@gmail.com",
+		Aud:   Audience{testAud},
+		Iss:   "https://accounts.google.com",
+		Claims: map[string]interface{}{
+			"role": "admin",
+			"sub":  "overridden",
+		},
+	}
+	token, certs, err := GenerateTestToken(testSigningKey(t), testKeyID, claims)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+
+	actual, err := VerifyGoogleIDToken(token, certs, testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != claims.Sub || actual.Email != claims.Email {
+		t.Errorf("got %v\nwant %v", actual, &claims)
+	}
+	if actual.Claims["role"] != "admin" {
+		t.Errorf("got %v\nwant %v", actual.Claims["role"], "admin")
+	}
+	if actual.ExpiresIn() < 59*time.Minute {
+		t.Errorf("got %v\nwant about an hour", actual.ExpiresIn())
+	}
+	if kid, _ := KeyID(token); kid != testKeyID {
+		t.Errorf("got %v\nwant %v", kid, testKeyID)
+	}
+}
+
+func TestGenerateTestTokenExpired(t *testing.T) {
+	claims := TokenInfo{
+		Aud: Audience{testAud},
+		Iss: "https://accounts.google.com",
+		Iat: NumericDate(time.Now().Add(-2 * time.Hour).Unix()),
+		Exp: NumericDate(time.Now().Add(-time.Hour).Unix()),
+	}
+	token, certs, err := GenerateTestToken(testSigningKey(t), testKeyID, claims)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if _, err := VerifyGoogleIDToken(token, certs, testAud); !errors.Is(err, ErrorTokenExpired) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenExpired)
+	}
+	if _, err := VerifyGoogleIDToken(token, testCerts(t), "other"); !errors.Is(err, ErrorTokenInvalidAudience) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidAudience)
+	}
+}
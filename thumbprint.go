@@ -0,0 +1,53 @@
+package GoogleIdTokenVerifier
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of key, as pinned by VerifyOptions.AllowedKeyThumbprints
+func (key *Key) Thumbprint() ([]byte, error) {
+	pub, err := parsePublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return thumbprint(pub)
+}
+
+// thumbprint hashes the required members of pub's JWK, in lexicographic order and without whitespace,
+// so that the result doesn't depend on how the JWKS happened to encode the key
+func thumbprint(pub crypto.PublicKey) ([]byte, error) {
+	key, err := publicKeyToKey(pub, "")
+	if err != nil {
+		return nil, err
+	}
+	var members string
+	switch key.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, key.E, key.N)
+	default:
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, key.Crv, key.X, key.Y)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return sum[:], nil
+}
+
+// checkKeyPinned returns an error unless the key in certs named kid has one of the allowed thumbprints
+func checkKeyPinned(certs *Certs, kid string, allowed [][]byte) error {
+	pub, err := certs.publicKey(kid)
+	if err != nil {
+		return err
+	}
+	actual, err := thumbprint(pub)
+	if err != nil {
+		return err
+	}
+	for _, thumbprint := range allowed {
+		if bytes.Equal(actual, thumbprint) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: kid %q", ErrorTokenKeyNotAllowed, kid)
+}
@@ -0,0 +1,69 @@
+package GoogleIdTokenVerifier
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestKeyThumbprint(t *testing.T) {
+	// The example from RFC 7638 section 3.1
+	key := &Key{
+		Kty: "RSA",
+		Kid: "2011-04-29",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	const expected = "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	actual, err := key.Thumbprint()
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if encoded := base64.RawURLEncoding.EncodeToString(actual); encoded != expected {
+		t.Errorf("got %v\nwant %v", encoded, expected)
+	}
+
+	// Members other than the required ones, and leading zeros in e, don't change the thumbprint
+	padded := *key
+	padded.Alg, padded.Use, padded.Kid, padded.E = "RS256", "sig", "other", "AAEAAQ"
+	if actual, err := padded.Thumbprint(); err != nil || base64.RawURLEncoding.EncodeToString(actual) != expected {
+		t.Errorf("got %v, %v\nwant %v", base64.RawURLEncoding.EncodeToString(actual), err, expected)
+	}
+
+	if _, err := (&Key{Kty: "oct", Kid: "secret"}).Thumbprint(); !errors.Is(err, ErrorTokenInvalidKey) {
+		t.Errorf("got %v\nwant %v", err, ErrorTokenInvalidKey)
+	}
+}
+
+func TestVerifyAllowedKeyThumbprints(t *testing.T) {
+	certs := testCerts(t)
+	pinned, err := certs.Keys[0].Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint: %v", err)
+	}
+	other, err := mustGetCerts(t, googleCertsJSON).Keys[0].Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint: %v", err)
+	}
+	tests := []struct {
+		name     string
+		allowed  [][]byte
+		expected error
+	}{
+		{"not pinned", nil, nil},
+		{"pinned", [][]byte{other, pinned}, nil},
+		{"outside allowlist", [][]byte{other}, ErrorTokenKeyNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := VerifyOptions{AllowedKeyThumbprints: tt.allowed}
+			actual, err := VerifyGoogleIDTokenWithOptions(signTestToken(t, nil, testClaims()), certs, testAud, opts)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("got %v\nwant %v", err, tt.expected)
+			}
+			if err == nil && actual.Sub != "110169484474386276334" {
+				t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+)
+
+// googleX509CertsURL serves the same keys as googleCertsURL, as a kid -> PEM certificate map
+const googleX509CertsURL = "https://www.googleapis.com/oauth2/v1/certs"
+
+var (
+	ErrorCertsInvalidPEM   error = errors.New("Certs are not valid, PEM block doesn't hold a supported public key")
+	ErrorCertsMissingKeyID error = errors.New("Certs are not valid, PEM block has no kid header")
+)
+
+// GetCertsFromX509URL fetches Google's certs from the legacy x509 endpoint, for environments
+// where the JWKS endpoint is unreachable. The result can be used anywhere a JWKS-sourced *Certs is
+func GetCertsFromX509URL(client *http.Client) (*Certs, error) {
+	return getCertsFromX509URL(context.Background(), client, googleX509CertsURL)
+}
+
+func getCertsFromX509URL(ctx context.Context, client *http.Client, url string) (*Certs, error) {
+	bt, err := getCertsFromURL(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	return parseX509Certs(bt)
+}
+
+// parseX509Certs converts a kid -> PEM certificate map into JWKS keys
+func parseX509Certs(bt []byte) (*Certs, error) {
+	var pems map[string]string
+	if err := json.Unmarshal(bt, &pems); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorCertsInvalidPEM, err)
+	}
+	kids := make([]string, 0, len(pems))
+	for kid := range pems {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	certs := &Certs{Keys: make([]Key, 0, len(kids))}
+	for _, kid := range kids {
+		block, _ := pem.Decode([]byte(pems[kid]))
+		if block == nil {
+			return nil, ErrorCertsInvalidPEM
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorCertsInvalidPEM, err)
+		}
+		key, err := publicKeyToKey(cert.PublicKey, kid)
+		if err != nil {
+			return nil, err
+		}
+		certs.Keys = append(certs.Keys, *key)
+	}
+	return certs, nil
+}
+
+// ParseCertsFromPEM parses one or more PEM encoded certificates or public keys so that tokens
+// can be verified with VerifyGoogleIDToken without any network access.
+// Each block must carry a kid header naming the key ID its tokens are signed with:
+//
+//	-----BEGIN CERTIFICATE-----
+//	kid: 6f7254101f56e41cf35c9926de84a2d552b4c6f1
+//
+//	MIIDJjCCAg6gAwIBAgIIY...
+//	-----END CERTIFICATE-----
+func ParseCertsFromPEM(pemBytes []byte) (*Certs, error) {
+	certs := &Certs{}
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		kid := block.Headers["kid"]
+		if kid == "" {
+			return nil, ErrorCertsMissingKeyID
+		}
+		pub, err := parsePEMPublicKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key, err := publicKeyToKey(pub, kid)
+		if err != nil {
+			return nil, err
+		}
+		certs.Keys = append(certs.Keys, *key)
+	}
+	if len(certs.Keys) == 0 {
+		return nil, ErrorCertsInvalidPEM
+	}
+	return certs, nil
+}
+
+func parsePEMPublicKey(block *pem.Block) (interface{}, error) {
+	var pub interface{}
+	var err error
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, ErrorCertsInvalidPEM
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorCertsInvalidPEM, err)
+	}
+	return pub, nil
+}
+
+// publicKeyToKey encodes an RSA or P-256 public key the way a JWKS would. Alg is left empty,
+// since a PEM key doesn't say which of the algorithms for its type it is used with
+func publicKeyToKey(pub interface{}, kid string) (*Key, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &Key{
+			Kty: "RSA",
+			Use: "sig",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, ErrorCertsInvalidPEM
+		}
+		return &Key{
+			Kty: "EC",
+			Use: "sig",
+			Kid: kid,
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}, nil
+	}
+	return nil, ErrorCertsInvalidPEM
+}
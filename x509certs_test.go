@@ -0,0 +1,186 @@
+package GoogleIdTokenVerifier
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificatePEM returns a self-signed certificate for testSigningKey, like those served by Google's v1 endpoint
+func testCertificatePEM(t testing.TB) string {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "securetoken.system.gserviceaccount.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &testSigningKey(t).PublicKey, testSigningKey(t))
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestGetCertsFromX509URL(t *testing.T) {
+	bt, err := json.Marshal(map[string]string{testKeyID: testCertificatePEM(t)})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bt)
+	}))
+	defer ts.Close()
+
+	certs, err := getCertsFromX509URL(context.Background(), ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := testCerts(t).Keys[0]
+	expected.Alg = ""
+	if len(certs.Keys) != 1 || certs.Keys[0] != expected {
+		t.Fatalf("got %+v\nwant [%+v]", certs.Keys, expected)
+	}
+
+	actual, err := VerifyGoogleIDToken(signTestToken(t, nil, testClaims()), certs, testAud)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	if actual.Sub != "110169484474386276334" {
+		t.Errorf("got %q\nwant %q", actual.Sub, "110169484474386276334")
+	}
+	header := map[string]interface{}{"alg": "RS512", "kid": testKeyID, "typ": "JWT"}
+	if _, err := VerifyGoogleIDToken(signTestToken(t, header, testClaims()), certs, testAud); err != nil {
+		t.Errorf("RS512: got %v\nwant nil", err)
+	}
+}
+
+func TestParseX509CertsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"not json", `<html></html>`},
+		{"not pem", `{"kid": "not a certificate"}`},
+		{"not a certificate", `{"kid": "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs, err := parseX509Certs([]byte(tt.json))
+			if err == nil {
+				t.Errorf("got nil\nwant error")
+			}
+			if certs != nil {
+				t.Errorf("got %v\nwant nil", certs)
+			}
+		})
+	}
+}
+
+// withKeyID adds a kid header to the first PEM block in pemString
+func withKeyID(t testing.TB, pemString, kid string) []byte {
+	block, _ := pem.Decode([]byte(pemString))
+	if block == nil {
+		t.Fatalf("decode PEM")
+	}
+	block.Headers = map[string]string{"kid": kid}
+	return pem.EncodeToMemory(block)
+}
+
+func TestParseCertsFromPEM(t *testing.T) {
+	certs, err := ParseCertsFromPEM(withKeyID(t, testCertificatePEM(t), testKeyID))
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := testCerts(t).Keys[0]
+	expected.Alg = ""
+	if len(certs.Keys) != 1 || certs.Keys[0] != expected {
+		t.Fatalf("got %+v\nwant [%+v]", certs.Keys, expected)
+	}
+	for _, alg := range []string{"RS256", "RS384", "RS512"} {
+		header := map[string]interface{}{"alg": alg, "kid": testKeyID, "typ": "JWT"}
+		if _, err := VerifyGoogleIDToken(signTestToken(t, header, testClaims()), certs, testAud); err != nil {
+			t.Errorf("%s: got %v\nwant nil", alg, err)
+		}
+	}
+}
+
+func TestParseCertsFromPEMBundle(t *testing.T) {
+	pub := &testSigningKey(t).PublicKey
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	ec := testECKey(t)
+	ecPKIX, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var bundle []byte
+	bundle = append(bundle, withKeyID(t, testCertificatePEM(t), "cert")...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{"kid": "pkix"}, Bytes: der})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Headers: map[string]string{"kid": "pkcs1"}, Bytes: x509.MarshalPKCS1PublicKey(pub)})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{"kid": "ec"}, Bytes: ecPKIX})...)
+
+	certs, err := ParseCertsFromPEM(bundle)
+	if err != nil {
+		t.Fatalf("got %v\nwant nil", err)
+	}
+	expected := []string{"cert", "pkix", "pkcs1", "ec"}
+	if len(certs.Keys) != len(expected) {
+		t.Fatalf("got %d keys\nwant %d", len(certs.Keys), len(expected))
+	}
+	for i, kid := range expected {
+		if certs.Keys[i].Kid != kid {
+			t.Errorf("got %q\nwant %q", certs.Keys[i].Kid, kid)
+		}
+	}
+	for _, kid := range expected[:3] {
+		header := map[string]interface{}{"alg": "RS256", "kid": kid, "typ": "JWT"}
+		if _, err := VerifyGoogleIDToken(signTestToken(t, header, testClaims()), certs, testAud); err != nil {
+			t.Errorf("%s: got %v\nwant nil", kid, err)
+		}
+	}
+	if certs.Keys[3].Kty != "EC" || certs.Keys[3].Crv != "P-256" {
+		t.Errorf("got %+v\nwant P-256 key", certs.Keys[3])
+	}
+}
+
+func TestParseCertsFromPEMInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		pem      []byte
+		expected error
+	}{
+		{"empty", nil, ErrorCertsInvalidPEM},
+		{"garbage", []byte("not pem"), ErrorCertsInvalidPEM},
+		{"missing kid", []byte(testCertificatePEM(t)), ErrorCertsMissingKeyID},
+		{"private key", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Headers: map[string]string{"kid": "k"}, Bytes: []byte{0}}), ErrorCertsInvalidPEM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs, err := ParseCertsFromPEM(tt.pem)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v\nwant %v", err, tt.expected)
+			}
+			if certs != nil {
+				t.Errorf("got %v\nwant nil", certs)
+			}
+		})
+	}
+
+	_, err := ParseCertsFromPEM([]byte(strings.Replace(string(withKeyID(t, testCertificatePEM(t), "k")), "MII", "AAA", 1)))
+	if err == nil {
+		t.Errorf("got nil\nwant error for corrupt certificate")
+	}
+}